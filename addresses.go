@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var hexAddressPattern = regexp.MustCompile(`^0x[0-9a-fA-F]{40}$`)
+
+// checksumAddress validates a 0x-prefixed 20-byte hex address and returns it
+// in EIP-55 casing. A mixed-case address must already carry a valid
+// checksum, since a wrong one means a character was mistyped.
+func checksumAddress(address string) (string, error) {
+	if !hexAddressPattern.MatchString(address) {
+		return "", fmt.Errorf("%q is not a 0x-prefixed 20-byte hex address", address)
+	}
+	checksummed := common.HexToAddress(address).Hex()
+	digits := address[2:]
+	if digits != strings.ToLower(digits) && digits != strings.ToUpper(digits) && address != checksummed {
+		return "", fmt.Errorf("%q fails its EIP-55 checksum, expected %s", address, checksummed)
+	}
+	return checksummed, nil
+}
+
+// checksumTokenAddresses returns addresses with every address in EIP-55
+// casing, or an error naming the first malformed one.
+func checksumTokenAddresses(addresses map[string]string) (map[string]string, error) {
+	checksummed := make(map[string]string, len(addresses))
+	for _, symbol := range slices.Sorted(maps.Keys(addresses)) {
+		address, err := checksumAddress(addresses[symbol])
+		if err != nil {
+			return nil, fmt.Errorf("token %s: %w", symbol, err)
+		}
+		checksummed[symbol] = address
+	}
+	return checksummed, nil
+}
+
+// sharedAddresses maps each address registered under more than one symbol
+// to those symbols, sorted.
+func sharedAddresses(addresses map[string]string) map[string][]string {
+	symbols := make(map[string][]string)
+	for _, symbol := range slices.Sorted(maps.Keys(addresses)) {
+		address := common.HexToAddress(addresses[symbol]).Hex()
+		symbols[address] = append(symbols[address], symbol)
+	}
+	for address, shared := range symbols {
+		if len(shared) < 2 {
+			delete(symbols, address)
+		}
+	}
+	return symbols
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var adminToken = os.Getenv("ADMIN_TOKEN")
+
+// requireAdmin guards the /admin routes. They stay disabled entirely until an
+// ADMIN_TOKEN is configured.
+func requireAdmin(c *gin.Context) {
+	if adminToken == "" {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin endpoints are disabled: ADMIN_TOKEN is not set"})
+		return
+	}
+
+	token := c.GetHeader("X-Admin-Token")
+	if token == "" {
+		token = strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	}
+
+	if subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid admin token"})
+		return
+	}
+	c.Next()
+}
+
+// apiKeys, the comma-separated API_KEYS, guard the endpoints that can fan out
+// into many scrapes. With none configured they stay open.
+var apiKeys = parseAPIKeys(envString("API_KEYS", ""))
+
+func parseAPIKeys(value string) [][]byte {
+	var keys [][]byte
+	for _, key := range strings.Split(value, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, []byte(key))
+		}
+	}
+	return keys
+}
+
+// requireAPIKey accepts a key from X-API-Key or an Authorization bearer token.
+// Every configured key is compared so the timing doesn't tell which was close.
+func requireAPIKey(c *gin.Context) {
+	if len(apiKeys) == 0 {
+		c.Next()
+		return
+	}
+
+	key := c.GetHeader("X-API-Key")
+	if key == "" {
+		key = strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	}
+
+	valid := 0
+	for _, configured := range apiKeys {
+		valid |= subtle.ConstantTimeCompare([]byte(key), configured)
+	}
+	if key == "" || valid != 1 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing or invalid API key"})
+		return
+	}
+	c.Next()
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Price alerts: every ALERT_POLL_INTERVAL each registered pair is quoted
+// (through the cache, like any other request) and the Result is POSTed to the
+// alert's webhook when the rate crosses its threshold. An alert only fires on
+// the transition, not on every poll while the condition holds.
+var (
+	alertPollInterval = envDuration("ALERT_POLL_INTERVAL", time.Minute)
+	alertMaxRules     = envInt("ALERT_MAX_RULES", 100)
+)
+
+type PriceAlert struct {
+	ID        string  `json:"id"`
+	Input     string  `json:"input"`
+	Output    string  `json:"output"`
+	Amount    string  `json:"amount,omitempty"`
+	Direction string  `json:"direction"`
+	Rate      float64 `json:"rate"`
+	Webhook   string  `json:"webhook"`
+	CreatedAt string  `json:"created_at"`
+
+	Triggered     bool    `json:"triggered"`
+	LastRate      float64 `json:"last_rate,omitempty"`
+	LastCheckedAt string  `json:"last_checked_at,omitempty"`
+}
+
+func (a *PriceAlert) matches(rate float64) bool {
+	if a.Direction == "above" {
+		return rate > a.Rate
+	}
+	return rate < a.Rate
+}
+
+type AlertRegistry struct {
+	mutex  sync.Mutex
+	alerts map[string]*PriceAlert
+}
+
+func NewAlertRegistry() *AlertRegistry {
+	return &AlertRegistry{alerts: make(map[string]*PriceAlert)}
+}
+
+func (r *AlertRegistry) Add(alert *PriceAlert) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if len(r.alerts) >= alertMaxRules {
+		return fmt.Errorf("at most %d alerts can be registered", alertMaxRules)
+	}
+	r.alerts[alert.ID] = alert
+	return nil
+}
+
+func (r *AlertRegistry) Remove(id string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	_, ok := r.alerts[id]
+	delete(r.alerts, id)
+	return ok
+}
+
+// List returns copies of the registered alerts, oldest first.
+func (r *AlertRegistry) List() []PriceAlert {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	alerts := make([]PriceAlert, 0, len(r.alerts))
+	for _, alert := range r.alerts {
+		alerts = append(alerts, *alert)
+	}
+	sort.Slice(alerts, func(i, j int) bool { return alerts[i].CreatedAt < alerts[j].CreatedAt })
+	return alerts
+}
+
+// Check records a new rate for the alert and reports whether it just crossed
+// its threshold.
+func (r *AlertRegistry) Check(id string, rate float64) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	alert, ok := r.alerts[id]
+	if !ok {
+		return false
+	}
+	matched := alert.matches(rate)
+	fire := matched && !alert.Triggered
+	alert.Triggered = matched
+	alert.LastRate = rate
+	alert.LastCheckedAt = time.Now().Format(time.RFC3339)
+	return fire
+}
+
+var priceAlerts = NewAlertRegistry()
+
+func newAlertID() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+func handleCreateAlert(c *gin.Context) {
+	var alert PriceAlert
+	if err := c.ShouldBindJSON(&alert); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid alert: " + err.Error()})
+		return
+	}
+
+	if alert.Amount == "" {
+		alert.Amount = UNIT_AMOUNT
+	}
+	pair, err := validateBatchPair(BatchPair{Input: alert.Input, Output: alert.Output, Amount: alert.Amount})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if alert.Direction != "above" && alert.Direction != "below" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "direction must be above or below"})
+		return
+	}
+	if alert.Rate <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "rate must be greater than zero"})
+		return
+	}
+	if webhook, err := url.Parse(alert.Webhook); err != nil || (webhook.Scheme != "http" && webhook.Scheme != "https") || webhook.Host == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "webhook must be an http or https URL"})
+		return
+	}
+
+	alert.ID = newAlertID()
+	alert.Input, alert.Output, alert.Amount = pair.Input, pair.Output, pair.Amount
+	alert.CreatedAt = time.Now().Format(time.RFC3339)
+	alert.Triggered, alert.LastRate, alert.LastCheckedAt = false, 0, ""
+	if err := priceAlerts.Add(&alert); err != nil {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		return
+	}
+	log.Printf("[ALERT] Registered %s: %s to %s %s %v", alert.ID, alert.Input, alert.Output, alert.Direction, alert.Rate)
+	c.JSON(http.StatusCreated, alert)
+}
+
+func handleListAlerts(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"alerts": priceAlerts.List()})
+}
+
+func handleDeleteAlert(c *gin.Context) {
+	id := c.Param("id")
+	if !priceAlerts.Remove(id) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no such alert: " + id})
+		return
+	}
+	log.Printf("[ALERT] Removed %s", id)
+	c.JSON(http.StatusOK, gin.H{"id": id, "removed": true})
+}
+
+// runAlertPoller checks every alert each ALERT_POLL_INTERVAL until ctx is
+// done. Alerts on the same pair and amount share one quote.
+func runAlertPoller(ctx context.Context) {
+	ticker := time.NewTicker(alertPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		quotes := make(map[string]Result)
+		for _, alert := range priceAlerts.List() {
+			key := cacheKey(alert.Input, alert.Output, alert.Amount)
+			result, ok := quotes[key]
+			if !ok {
+				var err error
+				result, _, err = resolveQuote(withPriority(ctx, PriorityLow), alert.Input, alert.Output, alert.Amount, false)
+				if err != nil {
+					log.Printf("[ALERT] Failed to quote %s to %s for %s: %v", alert.Input, alert.Output, alert.ID, err)
+					continue
+				}
+				quotes[key] = result
+			}
+			if priceAlerts.Check(alert.ID, result.ExchangeRate) {
+				go notifyAlertWebhook(alert, result)
+			}
+		}
+	}
+}
+
+func notifyAlertWebhook(alert PriceAlert, result Result) {
+	payload, err := json.Marshal(result)
+	if err != nil {
+		log.Printf("[ALERT] Failed to encode webhook payload: %v", err)
+		return
+	}
+
+	request, err := http.NewRequest(http.MethodPost, alert.Webhook, bytes.NewReader(payload))
+	if err != nil {
+		log.Printf("[ALERT] Failed to build webhook request for %s: %v", alert.ID, err)
+		return
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Alert-ID", alert.ID)
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(request)
+	if err != nil {
+		log.Printf("[ALERT] Failed to deliver webhook for %s: %v", alert.ID, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("[ALERT] Webhook for %s responded with status %d", alert.ID, resp.StatusCode)
+		return
+	}
+	log.Printf("[ALERT] %s fired: %s to %s at %v", alert.ID, alert.Input, alert.Output, result.ExchangeRate)
+}
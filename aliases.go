@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// defaultTokenAliases are symbols that kuru quotes through another token:
+// wmon trades as mon. TOKEN_ALIASES (a JSON object) overrides or extends
+// these; mapping a symbol to "" removes its alias.
+var defaultTokenAliases = map[string]string{
+	"wmon": "mon",
+}
+
+var tokenAliases = defaultTokenAliases
+
+func loadTokenAliases(value string) (map[string]string, error) {
+	aliases := make(map[string]string, len(defaultTokenAliases))
+	for alias, target := range defaultTokenAliases {
+		aliases[alias] = target
+	}
+	if value == "" {
+		return aliases, nil
+	}
+
+	var configured map[string]string
+	if err := json.Unmarshal([]byte(value), &configured); err != nil {
+		return nil, fmt.Errorf("invalid TOKEN_ALIASES: %w", err)
+	}
+	for alias, target := range configured {
+		alias, target = strings.ToLower(alias), strings.ToLower(target)
+		if target == "" || target == alias {
+			delete(aliases, alias)
+			continue
+		}
+		if _, exists := tokenAddresses[target]; !exists {
+			return nil, fmt.Errorf("TOKEN_ALIASES maps %s to unknown token %s", alias, target)
+		}
+		aliases[alias] = target
+	}
+	return aliases, nil
+}
+
+// normalizeToken lowercases a requested symbol and resolves its alias, so
+// every spelling of a token shares one cache entry.
+func normalizeToken(token string) string {
+	token = strings.ToLower(strings.TrimSpace(token))
+	if target, ok := tokenAliases[token]; ok {
+		return target
+	}
+	return token
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	BASKET_QUOTE_TOKEN = "usdc"
+	BASKET_MAX_ITEMS   = 50
+)
+
+var basketConcurrency = envInt("BASKET_CONCURRENCY", 4)
+
+type BasketItem struct {
+	Token  string      `json:"token"`
+	Amount json.Number `json:"amount"`
+}
+
+type BasketValue struct {
+	Token  string  `json:"token"`
+	Amount float64 `json:"amount"`
+	Value  float64 `json:"value"`
+	Cached bool    `json:"cached"`
+	Error  string  `json:"error,omitempty"`
+}
+
+type BasketResponse struct {
+	QuoteToken string        `json:"quote_token"`
+	Items      []BasketValue `json:"items"`
+	Total      float64       `json:"total"`
+}
+
+// quoteBasketItem values one item in BASKET_QUOTE_TOKEN. Items already in the
+// quote token, or one sharing its address, are worth their amount.
+func quoteBasketItem(c *gin.Context, item BasketItem) BasketValue {
+	value := BasketValue{Token: item.Token}
+
+	pair, err := validateBatchPair(BatchPair{Input: item.Token, Output: BASKET_QUOTE_TOKEN, Amount: item.Amount.String()})
+	value.Token = pair.Input
+	if errors.Is(err, errSameToken) {
+		pair.Amount = canonicalAmount(pair.Amount)
+		err = validateAmount(pair.Input, pair.Amount)
+	}
+	if err != nil {
+		value.Error = err.Error()
+		return value
+	}
+	value.Amount, _ = strconv.ParseFloat(pair.Amount, 64)
+
+	if sameToken(pair.Input, BASKET_QUOTE_TOKEN) {
+		value.Value = value.Amount
+		return value
+	}
+
+	result, cached, err := getQuote(pair.Input, BASKET_QUOTE_TOKEN, pair.Amount)
+	if err != nil {
+		value.Error = err.Error()
+		return value
+	}
+	auditQuote(c, result)
+	value.Value = result.Output.Amount
+	value.Cached = cached
+	return value
+}
+
+func handleBasket(c *gin.Context) {
+	var items []BasketItem
+	if err := c.ShouldBindJSON(&items); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid basket: " + err.Error()})
+		return
+	}
+
+	if len(items) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "basket must contain at least one item"})
+		return
+	}
+	if len(items) > BASKET_MAX_ITEMS {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("basket can contain at most %d items", BASKET_MAX_ITEMS)})
+		return
+	}
+
+	response := BasketResponse{
+		QuoteToken: BASKET_QUOTE_TOKEN,
+		Items:      make([]BasketValue, len(items)),
+	}
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, max(basketConcurrency, 1))
+	for i, item := range items {
+		wg.Add(1)
+		go func(i int, item BasketItem) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			response.Items[i] = quoteBasketItem(c, item)
+		}(i, item)
+	}
+	wg.Wait()
+
+	for _, item := range response.Items {
+		if item.Error == "" {
+			response.Total += item.Value
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
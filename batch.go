@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+const BATCH_MAX_PAIRS = 50
+
+var batchConcurrency = envInt("BATCH_CONCURRENCY", 4)
+
+type BatchPair struct {
+	Input  string `json:"input"`
+	Output string `json:"output"`
+	Amount string `json:"amount"`
+}
+
+type BatchRequest struct {
+	Pairs []BatchPair `json:"pairs"`
+}
+
+var errSameToken = errors.New("input and output tokens must differ")
+
+// sameToken reports whether two supported symbols are the same token to kuru,
+// which they are whenever they share an address.
+func sameToken(a, b string) bool {
+	return strings.EqualFold(tokenAddresses[a], tokenAddresses[b])
+}
+
+// validateBatchPair resolves aliases and checks the pair the same way the
+// single quote route does.
+func validateBatchPair(pair BatchPair) (BatchPair, error) {
+	pair.Input, pair.Output = normalizeToken(pair.Input), normalizeToken(pair.Output)
+	if pair.Input == "" || pair.Output == "" || pair.Amount == "" {
+		return pair, fmt.Errorf("input, output, and amount are required")
+	}
+	if _, exists := tokenAddresses[pair.Input]; !exists {
+		return pair, fmt.Errorf("unsupported input token: %s", pair.Input)
+	}
+	if _, exists := tokenAddresses[pair.Output]; !exists {
+		return pair, fmt.Errorf("unsupported output token: %s", pair.Output)
+	}
+	if sameToken(pair.Input, pair.Output) {
+		return pair, errSameToken
+	}
+	amount := canonicalAmount(pair.Amount)
+	if err := validateAmount(pair.Input, amount); err != nil {
+		return pair, err
+	}
+	amount, err := fitAmountLength(amount)
+	if err != nil {
+		return pair, err
+	}
+	pair.Amount = amount
+	return pair, nil
+}
+
+// handleBatchPrice quotes several pairs in one request. Cached pairs are
+// answered straight away and only the misses are scraped, BATCH_CONCURRENCY
+// at a time. Results keep the order of the request and a failing pair gets an
+// error element instead of failing the batch.
+func handleBatchPrice(c *gin.Context) {
+	var request BatchRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid batch: " + err.Error()})
+		return
+	}
+
+	if len(request.Pairs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "batch must contain at least one pair"})
+		return
+	}
+	if len(request.Pairs) > BATCH_MAX_PAIRS {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("batch can contain at most %d pairs", BATCH_MAX_PAIRS)})
+		return
+	}
+
+	results := make([]interface{}, len(request.Pairs))
+	var misses []int
+	for i, pair := range request.Pairs {
+		pair, err := validateBatchPair(pair)
+		if err != nil {
+			results[i] = gin.H{"error": err.Error()}
+			continue
+		}
+		request.Pairs[i] = pair
+
+		if cachedResult, found := cache.Get(pair.Input, pair.Output, cacheKeyAmount(pair.Amount)); found && !isInvalidResult(cachedResult) {
+			cachedResult.Source = "cache"
+			results[i] = cachedResult
+			continue
+		}
+		misses = append(misses, i)
+	}
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, max(batchConcurrency, 1))
+	for _, i := range misses {
+		wg.Add(1)
+		go func(i int, pair BatchPair) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			result, _, err := resolveQuote(c.Request.Context(), pair.Input, pair.Output, pair.Amount, false)
+			if err != nil {
+				results[i] = gin.H{"error": err.Error()}
+				return
+			}
+			results[i] = result
+		}(i, request.Pairs[i])
+	}
+	wg.Wait()
+
+	auditQuotes(c, results)
+	c.JSON(http.StatusOK, results)
+}
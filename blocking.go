@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/chromedp/cdproto/fetch"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+)
+
+// Requests the swap page doesn't need to render a quote can be aborted so
+// navigation doesn't wait on them. BLOCK_RESOURCE_TYPES lists Chrome resource
+// types (Image, Font, Media, Stylesheet, ...) and BLOCK_DOMAINS hosts whose
+// subdomains are blocked as well, e.g. "google-analytics.com,hotjar.com".
+// Both are empty by default, which leaves every request alone.
+var (
+	blockedResourceTypes map[network.ResourceType]bool
+	blockedDomains       = parseBlockedDomains(envString("BLOCK_DOMAINS", ""))
+)
+
+var knownResourceTypes = []network.ResourceType{
+	network.ResourceTypeDocument, network.ResourceTypeStylesheet, network.ResourceTypeImage,
+	network.ResourceTypeMedia, network.ResourceTypeFont, network.ResourceTypeScript,
+	network.ResourceTypeTextTrack, network.ResourceTypeXHR, network.ResourceTypeFetch,
+	network.ResourceTypePrefetch, network.ResourceTypeEventSource, network.ResourceTypeWebSocket,
+	network.ResourceTypeManifest, network.ResourceTypePing, network.ResourceTypeOther,
+}
+
+func parseResourceTypes(value string) (map[network.ResourceType]bool, error) {
+	types := make(map[network.ResourceType]bool)
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		found := false
+		for _, known := range knownResourceTypes {
+			if strings.EqualFold(name, string(known)) {
+				types[known], found = true, true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown resource type %q in BLOCK_RESOURCE_TYPES", name)
+		}
+	}
+	return types, nil
+}
+
+func parseBlockedDomains(value string) []string {
+	var domains []string
+	for _, domain := range strings.Split(value, ",") {
+		if domain = strings.ToLower(strings.TrimSpace(domain)); domain != "" {
+			domains = append(domains, strings.TrimPrefix(domain, "."))
+		}
+	}
+	return domains
+}
+
+func blockedDomain(requestURL string) bool {
+	parsed, err := url.Parse(requestURL)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(parsed.Hostname())
+	for _, domain := range blockedDomains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// blockRequests intercepts the tab's requests and fails the blocked ones. It
+// is run once per tab. When only resource types are blocked, only requests of
+// those types are intercepted at all.
+func blockRequests() chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		if len(blockedResourceTypes) == 0 && len(blockedDomains) == 0 {
+			return nil
+		}
+
+		chromedp.ListenTarget(ctx, func(event interface{}) {
+			paused, ok := event.(*fetch.EventRequestPaused)
+			if !ok {
+				return
+			}
+			// commands can't be sent from inside the listener
+			go func() {
+				var err error
+				if blockedResourceTypes[paused.ResourceType] || blockedDomain(paused.Request.URL) {
+					err = fetch.FailRequest(paused.RequestID, network.ErrorReasonBlockedByClient).Do(ctx)
+				} else {
+					err = fetch.ContinueRequest(paused.RequestID).Do(ctx)
+				}
+				if err != nil && ctx.Err() == nil {
+					log.Printf("[BLOCK] Handling request to %s: %v", paused.Request.URL, err)
+				}
+			}()
+		})
+
+		var patterns []*fetch.RequestPattern
+		if len(blockedDomains) > 0 {
+			patterns = append(patterns, &fetch.RequestPattern{URLPattern: "*"})
+		} else {
+			for resourceType := range blockedResourceTypes {
+				patterns = append(patterns, &fetch.RequestPattern{URLPattern: "*", ResourceType: resourceType})
+			}
+		}
+		return fetch.Enable().WithPatterns(patterns).Do(ctx)
+	})
+}
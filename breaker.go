@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// The circuit breaker around kuru scrapes. After BREAKER_FAILURES consecutive
+// failed fetches it opens and every fetch fails fast for BREAKER_COOLDOWN.
+// Then a single probe is let through: success closes the circuit, failure
+// opens it for another cooldown. BREAKER_FAILURES=0 turns the breaker off.
+var (
+	breakerFailures = envInt("BREAKER_FAILURES", 5)
+	breakerCooldown = envDuration("BREAKER_COOLDOWN", 30*time.Second)
+)
+
+var errCircuitOpen = errors.New("kuru is failing, circuit breaker open")
+
+type CircuitState int
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitHalfOpen
+	CircuitOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitHalfOpen:
+		return "half_open"
+	case CircuitOpen:
+		return "open"
+	}
+	return "closed"
+}
+
+type CircuitBreaker struct {
+	mutex     sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openedAt  time.Time
+	probing   bool
+}
+
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+func (b *CircuitBreaker) stateLocked() CircuitState {
+	if b.threshold <= 0 || b.failures < b.threshold {
+		return CircuitClosed
+	}
+	if time.Since(b.openedAt) < b.cooldown {
+		return CircuitOpen
+	}
+	return CircuitHalfOpen
+}
+
+func (b *CircuitBreaker) State() CircuitState {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.stateLocked()
+}
+
+// Allow reports whether a fetch may go ahead. While half open only one probe
+// is allowed at a time.
+func (b *CircuitBreaker) Allow() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	switch b.stateLocked() {
+	case CircuitOpen:
+		return fmt.Errorf("%w, retrying in %v", errCircuitOpen, (b.cooldown - time.Since(b.openedAt)).Round(time.Second))
+	case CircuitHalfOpen:
+		if b.probing {
+			return fmt.Errorf("%w, probe in progress", errCircuitOpen)
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// Record counts the outcome of an allowed fetch. A missing route still means
+// kuru answered, while a cancelled request or a full pool says nothing about
+// kuru and only frees the probe.
+func (b *CircuitBreaker) Record(err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	wasProbing := b.probing
+	b.probing = false
+	switch {
+	case err == nil, errors.Is(err, errNoRoute):
+		if b.failures >= b.threshold && b.threshold > 0 {
+			log.Printf("[BREAKER] Closed, kuru is answering again")
+		}
+		b.failures = 0
+	case errors.Is(err, context.Canceled), errors.Is(err, errPoolSaturated):
+	default:
+		b.failures++
+		if b.threshold > 0 && (b.failures == b.threshold || wasProbing) {
+			b.openedAt = time.Now()
+			log.Printf("[BREAKER] Open for %v after %d consecutive failures: %v", b.cooldown, b.failures, err)
+		}
+	}
+}
+
+var kuruBreaker = NewCircuitBreaker(breakerFailures, breakerCooldown)
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTokenPairCacheSetGet(t *testing.T) {
+	c := NewTokenPairCache()
+	result := liveResult("mon", "usdc", 1, 3.2)
+
+	if _, found := c.Get("mon", "usdc", "1"); found {
+		t.Fatal("empty cache reported a hit")
+	}
+	c.Set("mon", "usdc", "1", result)
+
+	got, found := c.Get("mon", "usdc", "1")
+	if !found {
+		t.Fatal("cached quote not found")
+	}
+	if got.ExchangeRate != result.ExchangeRate {
+		t.Errorf("exchange rate = %v, want %v", got.ExchangeRate, result.ExchangeRate)
+	}
+	if _, found := c.Get("usdc", "mon", "1"); found {
+		t.Error("reverse pair served from the forward entry")
+	}
+	if _, found := c.Get("mon", "usdc", "2"); found {
+		t.Error("other amount served from the entry for 1")
+	}
+
+	hits, misses := c.Counters()
+	if hits != 1 || misses != 3 {
+		t.Errorf("counters = %d hits, %d misses, want 1 and 3", hits, misses)
+	}
+}
+
+func TestTokenPairCacheExpiry(t *testing.T) {
+	c := NewTokenPairCache()
+	c.setLocal("mon", "usdc", "1", CacheEntry{
+		Result:    liveResult("mon", "usdc", 1, 3.2),
+		ExpiresAt: time.Now().Add(-time.Second),
+	})
+
+	if _, found := c.Get("mon", "usdc", "1"); found {
+		t.Error("expired entry served")
+	}
+	if _, found := c.GetEntry("mon", "usdc", "1"); !found {
+		t.Error("expired entry not kept for fallbacks")
+	}
+	if c.Expired() != 1 {
+		t.Errorf("Expired() = %d, want 1", c.Expired())
+	}
+}
+
+func TestTokenPairCacheKeepsNewerQuote(t *testing.T) {
+	c := NewTokenPairCache()
+	older := liveResult("mon", "usdc", 1, 3)
+	older.Timestamp = time.Now().Add(-time.Minute).Format(time.RFC3339)
+	newer := liveResult("mon", "usdc", 1, 4)
+
+	c.Set("mon", "usdc", "1", newer)
+	c.Set("mon", "usdc", "1", older)
+
+	got, _ := c.Get("mon", "usdc", "1")
+	if got.ExchangeRate != newer.ExchangeRate {
+		t.Errorf("exchange rate = %v, an older quote overwrote the newer one", got.ExchangeRate)
+	}
+}
+
+func TestTokenPairCacheReportsAge(t *testing.T) {
+	c := NewTokenPairCache()
+	c.setLocal("mon", "usdc", "1", CacheEntry{
+		Result:    liveResult("mon", "usdc", 1, 3.2),
+		CreatedAt: time.Now().Add(-30 * time.Second),
+		ExpiresAt: time.Now().Add(time.Minute),
+	})
+
+	got, _ := c.Get("mon", "usdc", "1")
+	if got.AgeSeconds < 30 || got.AgeSeconds > 31 {
+		t.Errorf("age = %vs, want about 30s", got.AgeSeconds)
+	}
+	if entry, _ := c.GetEntry("mon", "usdc", "1"); entry.Result.AgeSeconds != 0 {
+		t.Errorf("stored result has age %vs, want it set only when served", entry.Result.AgeSeconds)
+	}
+}
+
+func TestTokenPairCacheSweep(t *testing.T) {
+	c := NewTokenPairCache()
+	now := time.Now()
+	c.cache["mon"] = map[string]map[string]CacheEntry{
+		"usdc": {
+			"1": {ExpiresAt: now.Add(-time.Hour)},
+			"2": {ExpiresAt: now.Add(-time.Second)},
+		},
+		"dak": {"1": {ExpiresAt: now.Add(time.Hour)}},
+	}
+	c.cache["usdc"] = map[string]map[string]CacheEntry{
+		"mon": {"1": {ExpiresAt: now.Add(-time.Hour)}},
+	}
+
+	if removed := c.Sweep(time.Minute); removed != 2 {
+		t.Errorf("Sweep removed %d entries, want 2", removed)
+	}
+	if _, found := c.GetEntry("mon", "usdc", "2"); !found {
+		t.Error("entry inside the retention window was swept")
+	}
+	if _, found := c.cache["usdc"]; found {
+		t.Error("map emptied by the sweep was left behind")
+	}
+
+	if removed := c.Sweep(0); removed != 1 {
+		t.Errorf("Sweep(0) removed %d entries, want the 1 just expired", removed)
+	}
+	if _, found := c.GetEntry("mon", "dak", "1"); !found {
+		t.Error("unexpired entry was swept")
+	}
+}
+
+func TestTokenPairCacheEvictAndFlush(t *testing.T) {
+	c := NewTokenPairCache()
+	c.Set("mon", "usdc", "1", liveResult("mon", "usdc", 1, 3))
+	c.Set("usdc", "mon", "1", liveResult("usdc", "mon", 1, 0.3))
+	c.Set("dak", "eth", "1", liveResult("dak", "eth", 1, 0.01))
+
+	if removed := c.EvictToken("mon"); removed != 2 {
+		t.Errorf("EvictToken removed %d entries, want 2", removed)
+	}
+	if removed := c.Flush(); removed != 1 {
+		t.Errorf("Flush removed %d entries, want 1", removed)
+	}
+	if c.Len() != 0 {
+		t.Errorf("Len() = %d after flush", c.Len())
+	}
+}
+
+func TestRateCacheQuotesAnyAmount(t *testing.T) {
+	c := NewRateCache()
+	c.Set("mon", "usdc", liveResult("mon", "usdc", 10, 35.4))
+
+	got, found := c.Quote("mon", "usdc", "2")
+	if !found {
+		t.Fatal("rate not found")
+	}
+	if got.Output.Amount != 7.08 || got.ScaledFrom != 10 {
+		t.Errorf("output = %v scaled from %v, want 7.08 from 10", got.Output.Amount, got.ScaledFrom)
+	}
+	if _, found := c.Quote("usdc", "mon", "2"); found {
+		t.Error("reverse pair served from the forward rate")
+	}
+
+	c.Set("mon", "usdc", liveResult("mon", "usdc", 1, 3.6))
+	if c.Len() != 1 {
+		t.Errorf("Len() = %d, want one entry per pair", c.Len())
+	}
+	if got, _ := c.Quote("mon", "usdc", "2"); got.Output.Amount != 7.2 {
+		t.Errorf("output = %v, want 7.2 from the latest rate", got.Output.Amount)
+	}
+}
+
+func TestStoredCacheKey(t *testing.T) {
+	saved := rateCachePairs
+	t.Cleanup(func() { rateCachePairs = saved })
+	rateCachePairs = map[string]bool{pairKey("mon", "usdc"): true}
+
+	if got, want := storedCacheKey("mon", "usdc", "5"), pairKey("mon", "usdc"); got != want {
+		t.Errorf("rate-cached pair keyed %q, want %q", got, want)
+	}
+	if got, want := storedCacheKey("mon", "dak", "5"), cacheKey("mon", "dak", "5"); got != want {
+		t.Errorf("other pair keyed %q, want %q", got, want)
+	}
+}
+
+func TestTokenPairCacheHottest(t *testing.T) {
+	saved := keepaliveTopK
+	t.Cleanup(func() { keepaliveTopK = saved })
+	keepaliveTopK = 2
+
+	c := NewTokenPairCache()
+	c.Set("mon", "usdc", "1", liveResult("mon", "usdc", 1, 3.5))
+	c.Set("mon", "usdc", "5", liveResult("mon", "usdc", 5, 17.5))
+	c.Set("dak", "usdc", "1", liveResult("dak", "usdc", 1, 0.2))
+	for range 3 {
+		c.Get("mon", "usdc", "5")
+	}
+	c.Get("dak", "usdc", "1")
+	c.Get("dak", "usdc", "2")
+
+	hot := c.Hottest(2)
+	if len(hot) != 2 || hot[0].Amount != "5" || hot[0].Hits != 3 || hot[1].Input != "dak" {
+		t.Fatalf("Hottest(2) = %+v, want mon/usdc/5 then dak/usdc/1", hot)
+	}
+
+	c.DecayHits()
+	if hot := c.Hottest(5); len(hot) != 1 || hot[0].Hits != 1 {
+		t.Errorf("after decay Hottest = %+v, want only mon/usdc/5 with 1 hit", hot)
+	}
+
+	c.Flush()
+	c.Set("mon", "usdc", "5", liveResult("mon", "usdc", 5, 17.5))
+	if hot := c.Hottest(5); len(hot) != 0 {
+		t.Errorf("after flush Hottest = %+v, want the old hits forgotten", hot)
+	}
+
+	keepaliveTopK = 0
+	c.Get("mon", "usdc", "5")
+	if hot := c.Hottest(5); len(hot) != 0 {
+		t.Errorf("with keepalive off Hottest = %+v, want no hits counted", hot)
+	}
+}
+
+func TestTokenPairCacheConcurrentAccess(t *testing.T) {
+	c := NewTokenPairCache()
+	tokens := []string{"mon", "usdc", "dak", "eth"}
+	amounts := []string{"1", "2", "5"}
+
+	var wg sync.WaitGroup
+	for worker := range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 500 {
+				// half the workers share keys, the other half spread out so
+				// the inner maps get created concurrently
+				input := tokens[(worker+i)%len(tokens)]
+				output := tokens[(worker+i+1)%len(tokens)]
+				amount := amounts[i%len(amounts)]
+				if worker%2 == 0 {
+					input, output, amount = "mon", "usdc", "1"
+				}
+
+				c.Set(input, output, amount, liveResult(input, output, 1, 2))
+				if got, found := c.Get(input, output, amount); found && (got.Input.Token != input || got.Output.Token != output) {
+					t.Errorf("Get(%s, %s, %s) returned a %s to %s quote", input, output, amount, got.Input.Token, got.Output.Token)
+				}
+				switch i % 100 {
+				case 25:
+					c.Len()
+					c.Expired()
+				case 50:
+					c.Sweep(time.Hour)
+				case 75:
+					c.Hottest(3)
+					c.DecayHits()
+				case 90:
+					c.EvictToken("eth")
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if _, found := c.Get("mon", "usdc", "1"); !found {
+		t.Error("shared key missing after concurrent writes")
+	}
+	if c.Len() > len(tokens)*len(tokens)*len(amounts) {
+		t.Errorf("Len() = %d, more entries than distinct keys", c.Len())
+	}
+}
+
+func TestTokenPairCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	previous := cacheMaxEntries
+	cacheMaxEntries = 2
+	t.Cleanup(func() { cacheMaxEntries = previous })
+
+	c := NewTokenPairCache()
+	c.Set("mon", "usdc", "1", liveResult("mon", "usdc", 1, 3.5))
+	c.Set("mon", "usdc", "2", liveResult("mon", "usdc", 2, 7))
+	c.Get("mon", "usdc", "1")
+	c.Set("mon", "usdc", "3", liveResult("mon", "usdc", 3, 10.5))
+
+	if c.Len() != 2 || c.Evictions() != 1 {
+		t.Fatalf("Len() = %d after %d evictions, want 2 after 1", c.Len(), c.Evictions())
+	}
+	if _, found := c.Get("mon", "usdc", "2"); found {
+		t.Error("least recently used amount 2 survived")
+	}
+	for _, amount := range []string{"1", "3"} {
+		if _, found := c.Get("mon", "usdc", amount); !found {
+			t.Errorf("amount %s evicted", amount)
+		}
+	}
+
+	c.EvictToken("usdc")
+	c.Set("dak", "usdc", "1", liveResult("dak", "usdc", 1, 0.2))
+	if c.Len() != 1 || c.Evictions() != 1 {
+		t.Errorf("Len() = %d after %d evictions, want the evicted token's entries forgotten", c.Len(), c.Evictions())
+	}
+}
+
+func TestScrapeThrottleSweep(t *testing.T) {
+	saved := minScrapeInterval
+	t.Cleanup(func() { minScrapeInterval = saved })
+	minScrapeInterval = time.Minute
+
+	throttle := NewScrapeThrottle()
+	throttle.Record("mon", "usdc", "1", liveResult("mon", "usdc", 1, 3))
+	throttle.scrapes[pairKey("mon", "usdc")+"/2"] = recentScrape{scrapedAt: time.Now().Add(-time.Hour)}
+
+	if removed := throttle.Sweep(); removed != 1 {
+		t.Errorf("Sweep() = %d, want the hour-old scrape removed", removed)
+	}
+	if _, found := throttle.Recent("mon", "usdc", "1"); !found {
+		t.Error("scrape inside the interval swept")
+	}
+}
+
+func TestNegativeCacheSweep(t *testing.T) {
+	negative := NewNegativeCache()
+	negative.Record("mon", "usdc", "1")
+	negative.failures[pairKey("mon", "usdc")+"/2"] = time.Now().Add(-time.Second)
+
+	if removed := negative.Sweep(); removed != 1 {
+		t.Errorf("Sweep() = %d, want the expired failure removed", removed)
+	}
+	if !negative.Failed("mon", "usdc", "1") {
+		t.Error("failure inside the TTL swept")
+	}
+}
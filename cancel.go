@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// STATUS_CLIENT_CLOSED_REQUEST is the nginx convention for a request the
+// client gave up on before it was answered.
+const STATUS_CLIENT_CLOSED_REQUEST = 499
+
+// scrapeFlight is the context of one in-flight scrape shared through
+// scrapeGroup. It is cancelled once every request waiting on it has gone, so
+// a scrape nobody is waiting for stops holding a browser.
+type scrapeFlight struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	waiters int
+}
+
+var (
+	flightsMutex sync.Mutex
+	flights      = make(map[string]*scrapeFlight)
+)
+
+// joinFlight registers ctx as waiting on the scrape for key and returns the
+// context to run that scrape with. leave must be called when the caller is
+// done; it also runs on its own when ctx is cancelled.
+func joinFlight(ctx context.Context, key string) (flightCtx context.Context, leave func()) {
+	flightsMutex.Lock()
+	flight, ok := flights[key]
+	if !ok {
+		flightCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		flight = &scrapeFlight{ctx: flightCtx, cancel: cancel}
+		flights[key] = flight
+	}
+	flight.waiters++
+	flightsMutex.Unlock()
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			flightsMutex.Lock()
+			defer flightsMutex.Unlock()
+			flight.waiters--
+			if flight.waiters == 0 {
+				flight.cancel()
+				if flights[key] == flight {
+					delete(flights, key)
+				}
+			}
+		})
+	}
+	stop := context.AfterFunc(ctx, release)
+	return flight.ctx, func() {
+		stop()
+		release()
+	}
+}
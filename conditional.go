@@ -0,0 +1,60 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// quoteETag identifies a quote as presented to this request. The sequence
+// number only changes when a new quote is taken, and the query and content
+// negotiation headers cover the ways the same quote can be rendered. Quotes
+// without a sequence number, such as manual prices, get none.
+func quoteETag(c *gin.Context, result Result) string {
+	if result.Sequence == 0 {
+		return ""
+	}
+	variant := sha256.Sum256([]byte(c.Request.URL.RawQuery + "\n" + c.GetHeader("Accept") + "\n" + c.GetHeader("Accept-Version")))
+	return `W/"` + strconv.FormatUint(result.Sequence, 10) + "-" + hex.EncodeToString(variant[:6]) + `"`
+}
+
+// notModified sets ETag and Last-Modified for result and reports whether the
+// client's conditional headers show it already has it, in which case it has
+// been answered 304. If-None-Match takes precedence over If-Modified-Since.
+func notModified(c *gin.Context, result Result) bool {
+	etag := quoteETag(c, result)
+	if etag != "" {
+		c.Header("ETag", etag)
+	}
+	lastModified, err := time.Parse(time.RFC3339, result.Timestamp)
+	if err == nil {
+		c.Header("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if ifNoneMatch := c.GetHeader("If-None-Match"); ifNoneMatch != "" {
+		if etag == "" || !etagMatches(ifNoneMatch, etag) {
+			return false
+		}
+	} else if since, sinceErr := http.ParseTime(c.GetHeader("If-Modified-Since")); sinceErr != nil || err != nil || lastModified.After(since) {
+		return false
+	}
+
+	c.AbortWithStatus(http.StatusNotModified)
+	return true
+}
+
+// etagMatches compares weakly, as If-None-Match calls for.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
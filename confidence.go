@@ -0,0 +1,37 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// sourceConfidence is how much a quote is trusted based on where it came
+// from, before accounting for its age.
+var sourceConfidence = map[string]float64{
+	"live":            1,
+	"cache":           1,
+	"rpc":             0.8,
+	"stale_cache":     0.5,
+	"manual_override": 0.3,
+}
+
+// confidence scores a quote from 0 to 1 as the product of three factors:
+// its source, its age (falling linearly to zero at twice STALE_AFTER) and
+// how many attempts the scrape needed, each retry costing a tenth.
+func confidence(result Result) float64 {
+	score, found := sourceConfidence[result.Source]
+	if !found {
+		score = 0.5
+	}
+
+	if quotedAt, err := time.Parse(time.RFC3339, result.Timestamp); err == nil && staleAfter > 0 {
+		age := time.Since(quotedAt)
+		score *= math.Max(0, 1-age.Seconds()/(2*staleAfter.Seconds()))
+	}
+
+	if result.attempts > 1 {
+		score *= math.Max(0, 1-0.1*float64(result.attempts-1))
+	}
+
+	return math.Round(score*100) / 100
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+func envString(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	return fallback
+}
+
+func envInt(key string, fallback int) int {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("[CONFIG] Invalid %s=%q, using default %d", key, value, fallback)
+		return fallback
+	}
+	return parsed
+}
+
+func envFloat(key string, fallback float64) float64 {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Printf("[CONFIG] Invalid %s=%q, using default %v", key, value, fallback)
+		return fallback
+	}
+	return parsed
+}
+
+func envBool(key string, fallback bool) bool {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("[CONFIG] Invalid %s=%q, using default %t", key, value, fallback)
+		return fallback
+	}
+	return parsed
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return fallback
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("[CONFIG] Invalid %s=%q, using default %v", key, value, fallback)
+		return fallback
+	}
+	return parsed
+}
+
+// loadConfig parses and validates the settings a typo can make unusable, in
+// the order they depend on each other: token settings first, since the
+// others name tokens. main stops on the error before anything is served.
+func loadConfig() error {
+	var err error
+	if configuredTokens, err = loadTokensFile(envString("TOKENS_FILE", "")); err != nil {
+		return err
+	}
+	tokenAddresses = configuredTokens.addresses(tokenAddresses)
+	tokenDecimals = configuredTokens.decimalPlaces(tokenDecimals)
+	tokenChainDecimals = configuredTokens.chainDecimals(tokenChainDecimals)
+	if tokenAmountLimits, err = parseAmountLimits(envString("TOKEN_AMOUNT_LIMITS", ""), configuredTokens.amountLimits(tokenAmountLimits)); err != nil {
+		return err
+	}
+	if tokenAliases, err = loadTokenAliases(envString("TOKEN_ALIASES", "")); err != nil {
+		return err
+	}
+	if transferFeeBps, err = loadTransferFees(envString("TRANSFER_FEE_BPS", "")); err != nil {
+		return err
+	}
+	if spotAmounts, err = parseSpotAmounts(envString("SPOT_AMOUNTS", "")); err != nil {
+		return err
+	}
+
+	if dustPrecision, err = parseDustPrecision(envString("DUST_PRECISION", DUST_EXTEND)); err != nil {
+		return err
+	}
+	if rateSigFigs, err = parseRateSigFigs(envInt("RATE_SIG_FIGS", 10)); err != nil {
+		return err
+	}
+	if ratePresentations, err = parseRatePresentations(envString("RATE_PRESENTATION", "")); err != nil {
+		return err
+	}
+
+	template, err := swapURLTemplate(swapBaseURL)
+	if err != nil {
+		return err
+	}
+	swapURLTemplates = parseSwapURLTemplates(envString("SWAP_URL_TEMPLATES", ""), template)
+	if scrapeSelectors, err = loadSelectorConfig(envString("SELECTORS_FILE", ""), envSelectors()); err != nil {
+		return err
+	}
+	if blockedResourceTypes, err = parseResourceTypes(envString("BLOCK_RESOURCE_TYPES", "")); err != nil {
+		return err
+	}
+	if scrapeLocalStorage, err = parseLocalStorage(envString("SCRAPE_LOCAL_STORAGE", "")); err != nil {
+		return err
+	}
+
+	if quoterAddress, err = parseQuoterAddress(envString("QUOTER_ADDRESS", "")); err != nil {
+		return err
+	}
+	if quoterABI, err = parseQuoterABI(envString("QUOTER_ABI", UNISWAP_V2_ROUTER_ABI)); err != nil {
+		return err
+	}
+	if onchainPools, err = parseOnchainPools(envString("ONCHAIN_POOLS", "")); err != nil {
+		return err
+	}
+	fallbackChain = parseFallbackChain(envString("FALLBACK_CHAIN", defaultFallbackChain()))
+	if manualPrices, err = parseManualPrices(envString("MANUAL_PRICES", "")); err != nil {
+		return err
+	}
+
+	if signingKey, err = loadSigningKey(envString("SIGNING_KEY", "")); err != nil {
+		return err
+	}
+	if auditWriter, err = openAuditSink(envString("AUDIT_LOG", "")); err != nil {
+		return err
+	}
+	tlsCertFile, tlsKeyFile, err = parseTLSFiles(envString("TLS_CERT", ""), envString("TLS_KEY", ""))
+	return err
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	CORS_ALLOW_METHODS  = "GET, POST, DELETE, OPTIONS"
+	CORS_ALLOW_HEADERS  = "Accept, Accept-Version, Content-Type, Authorization, Cache-Control, If-None-Match, If-Modified-Since, X-Admin-Token, X-API-Key, X-Client-ID, X-Priority, X-Request-ID"
+	CORS_EXPOSE_HEADERS = "ETag, Last-Modified, Retry-After, X-Cache, X-Cache-Key, X-Request-ID, X-Schema-Version"
+	CORS_MAX_AGE        = "600"
+)
+
+// corsOrigins is the comma separated CORS_ALLOWED_ORIGINS allowlist. The
+// default "*" lets any origin call the API.
+var corsOrigins = parseOrigins(envString("CORS_ALLOWED_ORIGINS", "*"))
+
+func parseOrigins(value string) map[string]bool {
+	origins := make(map[string]bool)
+	for _, origin := range strings.Split(value, ",") {
+		if origin = strings.TrimRight(strings.TrimSpace(origin), "/"); origin != "" {
+			origins[origin] = true
+		}
+	}
+	return origins
+}
+
+// cors sets the CORS headers for allowed origins and answers preflight
+// requests itself, since no route is registered for OPTIONS.
+func cors(c *gin.Context) {
+	origin := c.GetHeader("Origin")
+	if origin == "" {
+		c.Next()
+		return
+	}
+
+	allowed := corsOrigins["*"] || corsOrigins[origin]
+	if allowed {
+		if corsOrigins["*"] {
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else {
+			c.Header("Access-Control-Allow-Origin", origin)
+			c.Writer.Header().Add("Vary", "Origin")
+		}
+		c.Header("Access-Control-Expose-Headers", CORS_EXPOSE_HEADERS)
+	}
+
+	if c.Request.Method == http.MethodOptions {
+		if allowed {
+			c.Header("Access-Control-Allow-Methods", CORS_ALLOW_METHODS)
+			c.Header("Access-Control-Allow-Headers", CORS_ALLOW_HEADERS)
+			c.Header("Access-Control-Max-Age", CORS_MAX_AGE)
+		}
+		c.AbortWithStatus(http.StatusNoContent)
+		return
+	}
+	c.Next()
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+const CURVE_MAX_POINTS = 20
+
+var curveConcurrency = envInt("CURVE_CONCURRENCY", 4)
+
+type CurvePoint struct {
+	Amount string  `json:"amount"`
+	Result *Result `json:"result,omitempty"`
+	Error  string  `json:"error,omitempty"`
+	// MarginalRate is the rate paid on the extra input since the previous
+	// point, which falls off faster than ExchangeRate as size grows.
+	MarginalRate float64 `json:"marginal_rate,omitempty"`
+}
+
+// handleCurve quotes one pair at several amounts, smallest first, so the
+// slippage curve can be plotted from a single request. Each amount is cached
+// like a normal quote.
+func handleCurve(c *gin.Context) {
+	inputToken := c.Query("input")
+	outputToken := c.DefaultQuery("output", defaultOutputToken)
+	amountsParam := c.Query("amounts")
+	if inputToken == "" || amountsParam == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "input and amounts parameters are required"})
+		return
+	}
+
+	var pairs []BatchPair
+	seen := make(map[string]bool)
+	for _, amount := range strings.Split(amountsParam, ",") {
+		pair, err := validateBatchPair(BatchPair{Input: inputToken, Output: outputToken, Amount: strings.TrimSpace(amount)})
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !seen[cacheKeyAmount(pair.Amount)] {
+			seen[cacheKeyAmount(pair.Amount)] = true
+			pairs = append(pairs, pair)
+		}
+	}
+	if len(pairs) > CURVE_MAX_POINTS {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("a curve can have at most %d amounts", CURVE_MAX_POINTS)})
+		return
+	}
+
+	points := make([]CurvePoint, len(pairs))
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, max(curveConcurrency, 1))
+	for i, pair := range pairs {
+		wg.Add(1)
+		go func(i int, pair BatchPair) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			points[i].Amount = pair.Amount
+			result, _, err := resolveQuote(c.Request.Context(), pair.Input, pair.Output, pair.Amount, false)
+			if err != nil {
+				points[i].Error = err.Error()
+				return
+			}
+			points[i].Result = &result
+		}(i, pair)
+	}
+	wg.Wait()
+
+	sort.Slice(points, func(i, j int) bool { return curveInput(points[i]) < curveInput(points[j]) })
+	var previous *Result
+	for i := range points {
+		current := points[i].Result
+		if current == nil {
+			continue
+		}
+		auditQuote(c, *current)
+		if previous != nil && current.Input.Amount > previous.Input.Amount {
+			points[i].MarginalRate = (current.Output.Amount - previous.Output.Amount) / (current.Input.Amount - previous.Input.Amount)
+		}
+		previous = current
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"input":  pairs[0].Input,
+		"output": pairs[0].Output,
+		"points": points,
+	})
+}
+
+func curveInput(point CurvePoint) float64 {
+	amount, _ := strconv.ParseFloat(point.Amount, 64)
+	return amount
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrorCode is the machine-readable "code" of an error response. Codes are
+// part of the API: clients branch on them, so they are never renamed.
+type ErrorCode string
+
+const (
+	CODE_INVALID_PARAMETER ErrorCode = "INVALID_PARAMETER"
+	CODE_UNSUPPORTED_TOKEN ErrorCode = "UNSUPPORTED_TOKEN"
+	CODE_INVALID_AMOUNT    ErrorCode = "INVALID_AMOUNT"
+	CODE_NO_ROUTE          ErrorCode = "NO_ROUTE"
+	CODE_UPSTREAM_TIMEOUT  ErrorCode = "UPSTREAM_TIMEOUT"
+	CODE_SCRAPE_FAILED     ErrorCode = "SCRAPE_FAILED"
+	CODE_SCRAPER_BROKEN    ErrorCode = "SCRAPER_BROKEN"
+	CODE_UNAVAILABLE       ErrorCode = "UNAVAILABLE"
+	CODE_STALE_QUOTE       ErrorCode = "STALE_QUOTE"
+	CODE_REQUEST_CANCELLED ErrorCode = "REQUEST_CANCELLED"
+	CODE_RPC_FAILED        ErrorCode = "RPC_FAILED"
+)
+
+// QuoteError is a failed fetch tagged with the code it is reported under.
+type QuoteError struct {
+	Code ErrorCode
+	Err  error
+}
+
+func (e *QuoteError) Error() string { return e.Err.Error() }
+
+func (e *QuoteError) Unwrap() error { return e.Err }
+
+// newScrapeError tags the error a scrape gave up with.
+func newScrapeError(err error) *QuoteError {
+	return &QuoteError{Code: errorCode(err), Err: err}
+}
+
+// errorCode classifies a quote failure, preferring the code it was tagged
+// with.
+func errorCode(err error) ErrorCode {
+	var quoteErr *QuoteError
+	switch {
+	case errors.As(err, &quoteErr):
+		return quoteErr.Code
+	case errors.Is(err, errPoolSaturated), errors.Is(err, errCircuitOpen), errors.Is(err, errMaintenance):
+		return CODE_UNAVAILABLE
+	case errors.Is(err, errNoRoute):
+		return CODE_NO_ROUTE
+	case errors.Is(err, errSelectorNotFound):
+		return CODE_SCRAPER_BROKEN
+	case errors.Is(err, context.DeadlineExceeded):
+		return CODE_UPSTREAM_TIMEOUT
+	}
+	return CODE_SCRAPE_FAILED
+}
+
+// errorStatus is the HTTP status a quote failure is answered with.
+func errorStatus(code ErrorCode) int {
+	switch code {
+	case CODE_INVALID_AMOUNT:
+		return http.StatusBadRequest
+	case CODE_UNAVAILABLE:
+		return http.StatusServiceUnavailable
+	case CODE_NO_ROUTE:
+		return http.StatusUnprocessableEntity
+	case CODE_SCRAPER_BROKEN:
+		return http.StatusBadGateway
+	case CODE_UPSTREAM_TIMEOUT:
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
+func respondError(c *gin.Context, status int, code ErrorCode, message string) {
+	c.JSON(status, gin.H{"error": message, "code": code})
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FALLBACK_CHAIN lists, in order, what to try when a live quote can't be
+// produced. Each entry is one of:
+//
+//	stale_cache      serve an expired cache entry up to STALE_MAX_AGE past expiry
+//	rpc              price from the QUOTER_ADDRESS contract or the ONCHAIN_POOLS
+//	                 reserves over MONAD_RPC_URL
+//	manual_override  synthesize a quote from the MANUAL_PRICES rate for the pair
+//	negative_cache   remember the failure for NEGATIVE_CACHE_TTL so repeated
+//	                 requests fail fast instead of scraping again, then stop
+//	error            stop and return the original error
+//
+// The default is just rpc when a QUOTER_ADDRESS is configured, otherwise an
+// empty chain, which returns the error straight away.
+var (
+	fallbackChain    []string
+	staleMaxAge      = envDuration("STALE_MAX_AGE", time.Hour)
+	negativeCacheTTL = envDuration("NEGATIVE_CACHE_TTL", 30*time.Second)
+	manualPrices     map[string]float64
+)
+
+// fallbackStrategy quotes amount, the requested amount rather than its cache
+// bucket, so a synthesized quote is for what the client asked.
+type fallbackStrategy func(inputToken, outputToken, amount string) (Result, bool)
+
+var fallbackStrategies = map[string]fallbackStrategy{
+	"stale_cache":     staleCacheFallback,
+	"rpc":             onchainFallback,
+	"manual_override": manualOverrideFallback,
+}
+
+var errNegativelyCached = errors.New("quote failed recently, not retrying yet")
+
+func defaultFallbackChain() string {
+	if quoterAddress != "" {
+		return "rpc"
+	}
+	return ""
+}
+
+func parseFallbackChain(value string) []string {
+	var chain []string
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, known := fallbackStrategies[name]; !known && name != "negative_cache" && name != "error" {
+			log.Printf("[CONFIG] Ignoring unknown fallback strategy %q", name)
+			continue
+		}
+		chain = append(chain, name)
+	}
+	return chain
+}
+
+// parseManualPrices reads MANUAL_PRICES, a JSON object of "input/output" pairs
+// to exchange rates, e.g. {"mon/usdc": 3.2}.
+func parseManualPrices(value string) (map[string]float64, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var prices map[string]float64
+	if err := json.Unmarshal([]byte(value), &prices); err != nil {
+		return nil, fmt.Errorf("invalid MANUAL_PRICES: %w", err)
+	}
+	return prices, nil
+}
+
+func negativeCachingEnabled() bool {
+	for _, name := range fallbackChain {
+		if name == "negative_cache" {
+			return true
+		}
+	}
+	return false
+}
+
+// applyFallbacks walks the configured chain after fetchErr and returns the
+// first result a strategy produces, tagged with the strategy's name. Without
+// allowStale the stale_cache strategy is skipped.
+func applyFallbacks(inputToken, outputToken, amount string, fetchErr error, allowStale bool) (Result, error) {
+	key := cacheKeyAmount(amount)
+	for _, name := range fallbackChain {
+		switch name {
+		case "stale_cache":
+			if !allowStale {
+				continue
+			}
+		case "error":
+			return Result{}, fetchErr
+		case "negative_cache":
+			if !errors.Is(fetchErr, errNegativelyCached) {
+				negativeCache.Record(inputToken, outputToken, key)
+			}
+			return Result{}, fetchErr
+		}
+
+		if result, ok := fallbackStrategies[name](inputToken, outputToken, amount); ok {
+			log.Printf("[FALLBACK] Served %s to %s from %s after: %v", inputToken, outputToken, name, fetchErr)
+			result.Source = name
+			return result, nil
+		}
+	}
+	return Result{}, fetchErr
+}
+
+func staleCacheFallback(inputToken, outputToken, amount string) (Result, bool) {
+	entry, found := cache.GetEntry(inputToken, outputToken, cacheKeyAmount(amount))
+	if !found || time.Since(entry.ExpiresAt) > staleMaxAge || isInvalidResult(entry.Result) {
+		return Result{}, false
+	}
+	return entry.served(), true
+}
+
+func manualOverrideFallback(inputToken, outputToken, amount string) (Result, bool) {
+	rate, found := manualPrices[pairKey(inputToken, outputToken)]
+	if !found || rate <= 0 {
+		return Result{}, false
+	}
+	inputAmount, err := strconv.ParseFloat(amount, 64)
+	if err != nil || inputAmount <= 0 {
+		return Result{}, false
+	}
+	return buildResult(inputToken, outputToken, inputAmount, inputAmount*rate, scrapedQuote{}), true
+}
+
+type NegativeCache struct {
+	mutex    sync.Mutex
+	failures map[string]time.Time
+}
+
+func NewNegativeCache() *NegativeCache {
+	return &NegativeCache{
+		failures: make(map[string]time.Time),
+	}
+}
+
+func (n *NegativeCache) Record(inputToken, outputToken, amount string) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	n.failures[pairKey(inputToken, outputToken)+"/"+amount] = time.Now().Add(negativeCacheTTL)
+}
+
+func (n *NegativeCache) Failed(inputToken, outputToken, amount string) bool {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	key := pairKey(inputToken, outputToken) + "/" + amount
+	until, found := n.failures[key]
+	if !found {
+		return false
+	}
+	if time.Now().After(until) {
+		delete(n.failures, key)
+		return false
+	}
+	return true
+}
+
+// Sweep drops the expired failures and returns how many were removed. Failed
+// only clears the keys it is asked about, so without it failures for amounts
+// that are never requested again would stay forever.
+func (n *NegativeCache) Sweep() int {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	removed := 0
+	now := time.Now()
+	for key, until := range n.failures {
+		if now.After(until) {
+			delete(n.failures, key)
+			removed++
+		}
+	}
+	return removed
+}
+
+var negativeCache = NewNegativeCache()
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// feedDecimals is the scale of the integer answer served by /feed. Chainlink
+// USD feeds use 8.
+var feedDecimals = envInt("FEED_DECIMALS", 8)
+
+// feedAnswer scales rate by 10^decimals and truncates it to an integer, the
+// way aggregator answers are reported.
+func feedAnswer(rate float64, decimals int) *big.Int {
+	scale := new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil))
+	answer, _ := new(big.Float).Mul(big.NewFloat(rate), scale).Int(nil)
+	return answer
+}
+
+// handleFeed serves the rate for one unit of input in the shape of a Chainlink
+// aggregator's latestRoundData. The round id is the quote's sequence number.
+func handleFeed(c *gin.Context) {
+	inputToken := normalizeToken(c.Query("input"))
+	outputToken := normalizeToken(c.Query("output"))
+	if inputToken == "" || outputToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "input and output parameters are required"})
+		return
+	}
+	if _, exists := tokenAddresses[inputToken]; !exists {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported input token: " + inputToken})
+		return
+	}
+	if _, exists := tokenAddresses[outputToken]; !exists {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported output token: " + outputToken})
+		return
+	}
+	if sameToken(inputToken, outputToken) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errSameToken.Error()})
+		return
+	}
+
+	result, _, err := getQuote(inputToken, outputToken, UNIT_AMOUNT)
+	if err != nil {
+		result, err = applyFallbacks(inputToken, outputToken, UNIT_AMOUNT, err, true)
+	}
+	if err != nil {
+		code := errorCode(err)
+		respondError(c, errorStatus(code), code, err.Error())
+		return
+	}
+
+	auditQuote(c, result)
+	updatedAt, err := time.Parse(time.RFC3339, result.Timestamp)
+	if err != nil {
+		updatedAt = time.Now()
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"roundId":   result.Sequence,
+		"answer":    feedAnswer(result.ExchangeRate, feedDecimals),
+		"decimals":  feedDecimals,
+		"updatedAt": updatedAt.Unix(),
+	})
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PairFreshness struct {
+	mutex       sync.RWMutex
+	lastUpdated map[string]time.Time
+}
+
+func NewPairFreshness() *PairFreshness {
+	return &PairFreshness{
+		lastUpdated: make(map[string]time.Time),
+	}
+}
+
+func pairKey(inputToken, outputToken string) string {
+	return inputToken + "/" + outputToken
+}
+
+func (f *PairFreshness) Touch(inputToken, outputToken string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.lastUpdated[pairKey(inputToken, outputToken)] = time.Now()
+}
+
+func (f *PairFreshness) Snapshot() map[string]string {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	snapshot := make(map[string]string, len(f.lastUpdated))
+	for pair, updated := range f.lastUpdated {
+		snapshot[pair] = updated.Format(time.RFC3339)
+	}
+	return snapshot
+}
+
+var freshness = NewPairFreshness()
+
+func handlePairFreshness(c *gin.Context) {
+	c.JSON(http.StatusOK, freshness.Snapshot())
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Responses of at least GZIP_MIN_SIZE bytes are gzipped for clients that
+// accept it. Set GZIP_ENABLED=false when a proxy in front already compresses.
+var (
+	gzipEnabled = envBool("GZIP_ENABLED", true)
+	gzipMinSize = envInt("GZIP_MIN_SIZE", 1024)
+)
+
+func compressible(contentType string) bool {
+	for _, prefix := range []string{"application/json", "application/javascript", "application/x-protobuf", "text/plain", "text/html"} {
+		if strings.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// gzipWriter holds back the start of the body until it knows whether the
+// response is big enough to be worth compressing.
+type gzipWriter struct {
+	gin.ResponseWriter
+	buffer  []byte
+	decided bool
+	gz      *gzip.Writer
+}
+
+func (w *gzipWriter) decide(compress bool) error {
+	w.decided = true
+	if compress {
+		header := w.Header()
+		header.Set("Content-Encoding", "gzip")
+		header.Del("Content-Length")
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+		_, err := w.gz.Write(w.buffer)
+		w.buffer = nil
+		return err
+	}
+	if len(w.buffer) == 0 {
+		return nil
+	}
+	_, err := w.ResponseWriter.Write(w.buffer)
+	w.buffer = nil
+	return err
+}
+
+func (w *gzipWriter) Write(data []byte) (int, error) {
+	if w.decided {
+		if w.gz != nil {
+			return w.gz.Write(data)
+		}
+		return w.ResponseWriter.Write(data)
+	}
+
+	if strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream") {
+		// events have to reach the client as they are written
+		if err := w.decide(false); err != nil {
+			return 0, err
+		}
+		return w.ResponseWriter.Write(data)
+	}
+
+	w.buffer = append(w.buffer, data...)
+	if len(w.buffer) >= gzipMinSize {
+		header := w.Header()
+		compress := header.Get("Content-Encoding") == "" && compressible(header.Get("Content-Type"))
+		if err := w.decide(compress); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+func (w *gzipWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Unwrap lets http.NewResponseController reach the connection, e.g. to lift
+// the write deadline for a stream.
+func (w *gzipWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Flush sends what is buffered uncompressed, streamed responses are not
+// worth holding back.
+func (w *gzipWriter) Flush() {
+	if !w.decided {
+		w.decide(false)
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+func (w *gzipWriter) close() {
+	if !w.decided {
+		w.decide(false)
+	}
+	if w.gz != nil {
+		w.gz.Close()
+	}
+}
+
+func gzipResponses(c *gin.Context) {
+	if !gzipEnabled {
+		c.Next()
+		return
+	}
+	// an identity response must not be served from a shared cache to a
+	// client that asked for gzip, or the other way round
+	c.Writer.Header().Add("Vary", "Accept-Encoding")
+	if !strings.Contains(c.GetHeader("Accept-Encoding"), "gzip") || strings.Contains(c.GetHeader("Accept"), "text/event-stream") {
+		c.Next()
+		return
+	}
+
+	writer := &gzipWriter{ResponseWriter: c.Writer}
+	c.Writer = writer
+	defer writer.close()
+	c.Next()
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/chromedp/chromedp"
+	"github.com/gin-gonic/gin"
+)
+
+var healthCheckTimeout = envDuration("HEALTH_CHECK_TIMEOUT", 10*time.Second)
+
+// checkBrowser opens a tab in the shared Chrome, launching it if needed, and
+// loads about:blank, which is what every scrape relies on.
+func checkBrowser() error {
+	tabCtx, cancel, err := newTab()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	ctx, cancelTimeout := context.WithTimeout(tabCtx, healthCheckTimeout)
+	defer cancelTimeout()
+	return chromedp.Run(ctx, chromedp.Navigate("about:blank"))
+}
+
+// handleHealth is a cheap liveness check. With deep=true it also verifies
+// Chrome works, for use as a readiness probe.
+func handleHealth(c *gin.Context) {
+	circuit, maintenance := kuruBreaker.State().String(), maintenanceMode.Load()
+	if c.Query("deep") != "true" {
+		c.JSON(http.StatusOK, gin.H{"status": "ok", "circuit": circuit, "maintenance": maintenance})
+		return
+	}
+
+	start := time.Now()
+	if err := checkBrowser(); err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "browser": err.Error(), "circuit": circuit, "maintenance": maintenance})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "browser": "ok", "browser_check_ms": time.Since(start).Milliseconds(), "circuit": circuit, "maintenance": maintenance})
+}
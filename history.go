@@ -0,0 +1,120 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	HISTORY_MAX_LEN       = 500
+	HISTORY_DEFAULT_LIMIT = 50
+)
+
+type QuotePoint struct {
+	Result     Result
+	Amount     string
+	RecordedAt time.Time
+}
+
+// QuoteHistory keeps a bounded, time-ordered list of recent live quotes per
+// pair. Once a pair holds maxLen points the oldest are dropped.
+type QuoteHistory struct {
+	mutex  sync.RWMutex
+	maxLen int
+	points map[string][]QuotePoint
+}
+
+func NewQuoteHistory(maxLen int) *QuoteHistory {
+	return &QuoteHistory{
+		maxLen: max(maxLen, 1),
+		points: make(map[string][]QuotePoint),
+	}
+}
+
+func (h *QuoteHistory) Record(inputToken, outputToken, amount string, result Result) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	key := pairKey(inputToken, outputToken)
+	points := append(h.points[key], QuotePoint{Result: result, Amount: amount, RecordedAt: time.Now()})
+	if len(points) > h.maxLen {
+		points = append([]QuotePoint(nil), points[len(points)-h.maxLen:]...)
+	}
+	h.points[key] = points
+}
+
+// Since returns the points recorded for the pair since the given time, oldest
+// first, along with the last point recorded before it (if any) so callers can
+// tell what the price was at the start of the window.
+func (h *QuoteHistory) Since(inputToken, outputToken string, since time.Time) ([]QuotePoint, *QuotePoint) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	points := h.points[pairKey(inputToken, outputToken)]
+	var previous *QuotePoint
+	for i, point := range points {
+		if !point.RecordedAt.Before(since) {
+			return append([]QuotePoint(nil), points[i:]...), previous
+		}
+		p := point
+		previous = &p
+	}
+	return nil, previous
+}
+
+// Recent returns up to limit of the pair's latest points, newest first.
+func (h *QuoteHistory) Recent(inputToken, outputToken string, limit int) []QuotePoint {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	points := h.points[pairKey(inputToken, outputToken)]
+	recent := make([]QuotePoint, 0, min(limit, len(points)))
+	for i := len(points) - 1; i >= 0 && len(recent) < limit; i-- {
+		recent = append(recent, points[i])
+	}
+	return recent
+}
+
+var quoteHistory = NewQuoteHistory(envInt("HISTORY_MAX_LEN", HISTORY_MAX_LEN))
+
+type HistoryPoint struct {
+	RecordedAt   string  `json:"recorded_at"`
+	Amount       string  `json:"amount"`
+	ExchangeRate float64 `json:"exchange_rate"`
+	Result       Result  `json:"result"`
+}
+
+func handleHistory(c *gin.Context) {
+	inputToken := normalizeToken(c.Query("input"))
+	outputToken := normalizeToken(c.Query("output"))
+	if inputToken == "" || outputToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "input and output parameters are required"})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(HISTORY_DEFAULT_LIMIT)))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+		return
+	}
+
+	points := quoteHistory.Recent(inputToken, outputToken, limit)
+	history := make([]HistoryPoint, len(points))
+	for i, point := range points {
+		history[i] = HistoryPoint{
+			RecordedAt:   point.RecordedAt.Format(time.RFC3339),
+			Amount:       point.Amount,
+			ExchangeRate: point.Result.ExchangeRate,
+			Result:       point.Result,
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"input":  inputToken,
+		"output": outputToken,
+		"points": history,
+	})
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"log"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// The keepalive re-quotes the KEEPALIVE_TOP_K most requested cache entries
+// once they are within KEEPALIVE_LEAD_TIME of expiring, checking every
+// KEEPALIVE_INTERVAL, so popular pairs never make a client wait for a
+// scrape. Refreshes run at low priority through the browser pool like any
+// other scrape. Hit counts are halved every check so popularity follows
+// recent traffic. A K of zero, the default, turns it off.
+var (
+	keepaliveTopK     = envInt("KEEPALIVE_TOP_K", 0)
+	keepaliveLeadTime = envDuration("KEEPALIVE_LEAD_TIME", time.Minute)
+	keepaliveInterval = envDuration("KEEPALIVE_INTERVAL", 30*time.Second)
+)
+
+// entryKey addresses one cache entry.
+type entryKey struct {
+	input  string
+	output string
+	amount string
+}
+
+// HotEntry is a cache entry ranked by how often it was hit.
+type HotEntry struct {
+	Input     string
+	Output    string
+	Amount    string
+	Hits      int64
+	ExpiresAt time.Time
+}
+
+func (c *TokenPairCache) recordKeyHit(key entryKey) {
+	counter, _ := c.keyHits.LoadOrStore(key, new(atomic.Int64))
+	counter.(*atomic.Int64).Add(1)
+}
+
+// Hottest returns up to k stored entries with the most hits, most hit first.
+func (c *TokenPairCache) Hottest(k int) []HotEntry {
+	var hot []HotEntry
+	c.keyHits.Range(func(key, counter any) bool {
+		entryKey := key.(entryKey)
+		entry, ok := c.GetEntry(entryKey.input, entryKey.output, entryKey.amount)
+		if hits := counter.(*atomic.Int64).Load(); ok && hits > 0 {
+			hot = append(hot, HotEntry{
+				Input:     entryKey.input,
+				Output:    entryKey.output,
+				Amount:    entryKey.amount,
+				Hits:      hits,
+				ExpiresAt: entry.ExpiresAt,
+			})
+		}
+		return true
+	})
+	slices.SortFunc(hot, func(a, b HotEntry) int {
+		return int(b.Hits - a.Hits)
+	})
+	return hot[:min(k, len(hot))]
+}
+
+// DecayHits halves every hit count, forgetting entries that drop to zero.
+func (c *TokenPairCache) DecayHits() {
+	c.keyHits.Range(func(key, counter any) bool {
+		hits := counter.(*atomic.Int64)
+		if hits.Load()/2 == 0 {
+			c.keyHits.Delete(key)
+		} else {
+			hits.Store(hits.Load() / 2)
+		}
+		return true
+	})
+}
+
+func runKeepalive(ctx context.Context) {
+	if keepaliveTopK <= 0 || keepaliveInterval <= 0 {
+		return
+	}
+	log.Printf("[KEEPALIVE] Keeping the top %d entries warm, refreshing %v before expiry", keepaliveTopK, keepaliveLeadTime)
+
+	ticker := time.NewTicker(keepaliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			refreshHotEntries(ctx)
+			cache.DecayHits()
+		}
+	}
+}
+
+// refreshHotEntries re-quotes the hottest entries that are about to expire.
+func refreshHotEntries(ctx context.Context) {
+	for _, entry := range cache.Hottest(keepaliveTopK) {
+		untilExpiry := time.Until(entry.ExpiresAt)
+		if untilExpiry <= 0 || untilExpiry > keepaliveLeadTime {
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		key := cacheKey(entry.Input, entry.Output, entry.Amount)
+		if _, _, err := resolveQuote(withPriority(ctx, PriorityLow), entry.Input, entry.Output, entry.Amount, true); err != nil {
+			log.Printf("[KEEPALIVE] Refresh of %s failed: %v", key, err)
+			continue
+		}
+		log.Printf("[KEEPALIVE] Refreshed %s (%d hits) %v before expiry", key, entry.Hits, untilExpiry.Round(time.Second))
+	}
+}
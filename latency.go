@@ -0,0 +1,35 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const MAX_SIMULATED_LATENCY = time.Minute
+
+// simulatedLatency delays every response for load testing clients against a
+// slow backend. While it is set, a request can pick its own delay with
+// ?delay_ms=. Zero, the default, turns simulation off.
+var simulatedLatency = time.Duration(envInt("SIMULATE_LATENCY_MS", 0)) * time.Millisecond
+
+func simulateLatency(c *gin.Context) {
+	if simulatedLatency <= 0 || c.FullPath() == "/ping" {
+		c.Next()
+		return
+	}
+
+	delay := simulatedLatency
+	if value := c.Query("delay_ms"); value != "" {
+		if ms, err := strconv.Atoi(value); err == nil && ms >= 0 {
+			delay = time.Duration(ms) * time.Millisecond
+		}
+	}
+
+	select {
+	case <-time.After(min(delay, MAX_SIMULATED_LATENCY)):
+	case <-c.Request.Context().Done():
+	}
+	c.Next()
+}
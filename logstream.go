@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const LOG_BUFFER_SIZE = 500
+
+// LogBuffer keeps the most recent log lines in a ring buffer and fans new
+// lines out to any connected subscribers.
+type LogBuffer struct {
+	mutex       sync.Mutex
+	lines       []string
+	next        int
+	full        bool
+	subscribers map[chan string]struct{}
+}
+
+func NewLogBuffer(size int) *LogBuffer {
+	return &LogBuffer{
+		lines:       make([]string, size),
+		subscribers: make(map[chan string]struct{}),
+	}
+}
+
+func (b *LogBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for _, line := range bytes.Split(bytes.TrimRight(p, "\n"), []byte("\n")) {
+		text := string(line)
+		b.lines[b.next] = text
+		b.next = (b.next + 1) % len(b.lines)
+		if b.next == 0 {
+			b.full = true
+		}
+		for sub := range b.subscribers {
+			select {
+			case sub <- text:
+			default:
+				// slow subscriber, drop the line rather than block logging
+			}
+		}
+	}
+	return len(p), nil
+}
+
+func (b *LogBuffer) Recent() []string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if !b.full {
+		return append([]string(nil), b.lines[:b.next]...)
+	}
+	return append(append([]string(nil), b.lines[b.next:]...), b.lines[:b.next]...)
+}
+
+func (b *LogBuffer) Subscribe() chan string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	sub := make(chan string, 100)
+	b.subscribers[sub] = struct{}{}
+	return sub
+}
+
+func (b *LogBuffer) Unsubscribe(sub chan string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	delete(b.subscribers, sub)
+}
+
+var logBuffer = NewLogBuffer(LOG_BUFFER_SIZE)
+
+func handleLogStream(c *gin.Context) {
+	sub := logBuffer.Subscribe()
+	defer logBuffer.Unsubscribe(sub)
+
+	// the stream is long-lived, so lift the server-wide write deadline for it
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+	backlog := logBuffer.Recent()
+	c.Stream(func(w io.Writer) bool {
+		if len(backlog) > 0 {
+			for _, line := range backlog {
+				c.SSEvent("log", line)
+			}
+			backlog = nil
+			return true
+		}
+
+		select {
+		case line := <-sub:
+			c.SSEvent("log", line)
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
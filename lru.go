@@ -0,0 +1,103 @@
+package main
+
+import (
+	"container/list"
+	"log"
+	"sync"
+)
+
+// cacheMaxEntries, CACHE_MAX_ENTRIES, bounds the quote cache. Once it is full
+// the least recently used entry is evicted for each new one, so a burst of
+// one-off amounts can't grow it without limit before the sweeper runs. Zero
+// or below leaves it unbounded.
+var cacheMaxEntries = envInt("CACHE_MAX_ENTRIES", 10000)
+
+// lruIndex orders cache entries by last use, most recent at the front. It
+// has a mutex of its own so cache reads, which only hold the cache's read
+// lock, can still record the access. The cache's lock is always taken first.
+type lruIndex struct {
+	mutex    sync.Mutex
+	order    *list.List
+	elements map[entryKey]*list.Element
+}
+
+func newLRUIndex() *lruIndex {
+	return &lruIndex{order: list.New(), elements: make(map[entryKey]*list.Element)}
+}
+
+func (l *lruIndex) touch(key entryKey) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if element, ok := l.elements[key]; ok {
+		l.order.MoveToFront(element)
+		return
+	}
+	l.elements[key] = l.order.PushFront(key)
+}
+
+func (l *lruIndex) forget(key entryKey) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if element, ok := l.elements[key]; ok {
+		l.order.Remove(element)
+		delete(l.elements, key)
+	}
+}
+
+// overflow returns the least recently used key once there are more than
+// limit.
+func (l *lruIndex) overflow(limit int) (entryKey, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if limit <= 0 || l.order.Len() <= limit {
+		return entryKey{}, false
+	}
+	return l.order.Back().Value.(entryKey), true
+}
+
+func (l *lruIndex) reset() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.order.Init()
+	l.elements = make(map[entryKey]*list.Element)
+}
+
+// deleteLocked removes one entry, pruning the maps it leaves empty. The
+// caller holds c.mutex.
+func (c *TokenPairCache) deleteLocked(key entryKey) {
+	if amounts, ok := c.cache[key.input][key.output]; ok {
+		delete(amounts, key.amount)
+		if len(amounts) == 0 {
+			delete(c.cache[key.input], key.output)
+		}
+		if len(c.cache[key.input]) == 0 {
+			delete(c.cache, key.input)
+		}
+	}
+	c.recency.forget(key)
+	c.keyHits.Delete(key)
+}
+
+// evictOverflowLocked drops least recently used entries until the cache fits
+// CACHE_MAX_ENTRIES. The caller holds c.mutex.
+func (c *TokenPairCache) evictOverflowLocked() {
+	for {
+		key, ok := c.recency.overflow(cacheMaxEntries)
+		if !ok {
+			return
+		}
+		c.deleteLocked(key)
+		if c.evictions.Add(1)%1000 == 1 {
+			log.Printf("[CACHE] Full at %d entries, evicting least recently used (%d so far)", cacheMaxEntries, c.evictions.Load())
+		}
+	}
+}
+
+// Evictions counts entries dropped to stay within CACHE_MAX_ENTRIES.
+func (c *TokenPairCache) Evictions() int64 {
+	return c.evictions.Load()
+}
@@ -2,28 +2,41 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"math"
 	"net/http"
+	"os"
+	"os/signal"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
-	"github.com/chromedp/chromedp"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/sync/singleflight"
 )
 
 const (
-	MON_ADDRESS  = "0x0000000000000000000000000000000000000000"
-	DAK_ADDRESS  = "0x0F0BDEbF0F83cD1EE3974779Bcb7315f9808c714"
-	LBTC_ADDRESS = "0x73a58b73018c1a417534232529b57b99132b13D2"
-	USDC_ADDRESS = "0xf817257fed379853cDe0fa4F97AB987181B1E5Ea"
-	USDT_ADDRESS = "0xf817257fed379853cDe0fa4F97AB987181B1E5Ea"
-	WETH_ADDRESS = "0xB5a30b0FDc5EA94A52fDc42e3E9760Cb8449Fb37"
-	WBTC_ADDRESS = "0xcf5a6076cfa32686c0Df13aBaDa2b40dec133F1d"
-	CACHE_TTL    = 5 * time.Minute
+	MON_ADDRESS       = "0x0000000000000000000000000000000000000000"
+	DAK_ADDRESS       = "0x0F0BDEbF0F83cD1EE3974779Bcb7315f9808c714"
+	LBTC_ADDRESS      = "0x73a58b73018c1a417534232529b57b99132b13D2"
+	USDC_ADDRESS      = "0xf817257fed379853cDe0fa4F97AB987181B1E5Ea"
+	USDT_ADDRESS      = "0x88b8E2161DEDC77EF4ab7585569D2415a1C1055D"
+	WETH_ADDRESS      = "0xB5a30b0FDc5EA94A52fDc42e3E9760Cb8449Fb37"
+	WBTC_ADDRESS      = "0xcf5a6076cfa32686c0Df13aBaDa2b40dec133F1d"
+	DEFAULT_PORT      = "3000"
+	DEFAULT_CACHE_TTL = 5 * time.Minute
+
+	DEFAULT_SWAP_BASE_URL = "https://kuru.io/swap"
 )
 
 var tokenAddresses = map[string]string{
@@ -37,6 +50,26 @@ var tokenAddresses = map[string]string{
 	"wbtc": WBTC_ADDRESS,
 }
 
+func sortedTokenSymbols() []string {
+	symbols := make([]string, 0, len(tokenAddresses))
+	for symbol := range tokenAddresses {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	return symbols
+}
+
+// symbolForAddress finds the registered symbol for a token address. Symbols
+// sharing an address resolve to the first one alphabetically.
+func symbolForAddress(address string) (string, bool) {
+	for _, symbol := range sortedTokenSymbols() {
+		if strings.EqualFold(tokenAddresses[symbol], address) {
+			return symbol, true
+		}
+	}
+	return "", false
+}
+
 type Result struct {
 	Input struct {
 		Amount float64 `json:"amount"`
@@ -47,26 +80,180 @@ type Result struct {
 		Token  string  `json:"token"`
 	} `json:"output"`
 	ExchangeRate float64 `json:"exchange_rate"`
-	Timestamp    string  `json:"timestamp"`
+	// NormalizedRate is left out of a quote for any amount but 1 unless a
+	// unit quote of the pair is cached or the request has ?normalized=true,
+	// which scrapes one. It is also left out when that scrape fails.
+	NormalizedRate       float64    `json:"normalized_rate,omitempty"`
+	GrossExchangeRate    float64    `json:"gross_exchange_rate,omitempty"`
+	Fee                  *Fee       `json:"fee,omitempty"`
+	QuotedDirection      string     `json:"quoted_direction,omitempty"`
+	RequestedAmount      float64    `json:"requested_amount,omitempty"`
+	Mirror               string     `json:"mirror,omitempty"`
+	PrecisionExtended    bool       `json:"precision_extended,omitempty"`
+	InputWei             string     `json:"input_wei,omitempty"`
+	OutputWei            string     `json:"output_wei,omitempty"`
+	Source               string     `json:"source,omitempty"`
+	InputUSDValue        float64    `json:"input_usd_value,omitempty"`
+	DisplayRate          float64    `json:"display_rate,omitempty"`
+	DisplayRateUnit      string     `json:"display_rate_unit,omitempty"`
+	EffectiveSlippageBps *float64   `json:"effective_slippage_bps,omitempty"`
+	Stale                bool       `json:"stale,omitempty"`
+	Sequence             uint64     `json:"sequence,omitempty"`
+	GrossOutputAmount    float64    `json:"gross_output_amount,omitempty"`
+	TransferFeeBps       float64    `json:"transfer_fee_bps,omitempty"`
+	Precision            *Precision `json:"precision,omitempty"`
+	InputAddress         string     `json:"input_address,omitempty"`
+	OutputAddress        string     `json:"output_address,omitempty"`
+	Confidence           float64    `json:"confidence,omitempty"`
+	ScaledFrom           float64    `json:"scaled_from,omitempty"`
+	PriceImpact          *float64   `json:"price_impact,omitempty"`
+	Estimated            bool       `json:"estimated,omitempty"`
+	Reverse              *Result    `json:"reverse,omitempty"`
+	ReciprocalRate       float64    `json:"reciprocal_rate,omitempty"`
+	Debug                *Debug     `json:"debug,omitempty"`
+	OutputUSD            float64    `json:"output_usd,omitempty"`
+	Mode                 string     `json:"mode,omitempty"`
+	SpotPrice            float64    `json:"spot_price,omitempty"`
+	AgeSeconds           float64    `json:"age_seconds"`
+	Side                 string     `json:"side,omitempty"`
+	Timestamp            string     `json:"timestamp"`
+	UnixTimestamp        int64      `json:"unix_timestamp"`
+	Signature            *Signature `json:"signature,omitempty"`
+
+	// rawOutputAmount is the scraped output before truncation to the token's
+	// decimal places. It only lives in memory and is zero when unknown.
+	rawOutputAmount float64
+	// attempts is how many scrapes it took to produce a live quote.
+	attempts int
+	// scraped is what was read off the page, for ?debug=true.
+	scraped scrapedQuote
+}
+
+type Signature struct {
+	Payload   string `json:"payload"`
+	Signature string `json:"signature"`
+	Signer    string `json:"signer"`
+}
+
+// Debug is what a quote was built from, returned with ?debug=true. The raw
+// values are only known for quotes scraped by this instance.
+type Debug struct {
+	RawInput        string  `json:"raw_input,omitempty"`
+	RawOutput       string  `json:"raw_output,omitempty"`
+	RawFee          string  `json:"raw_fee,omitempty"`
+	RawPriceImpact  string  `json:"raw_price_impact,omitempty"`
+	RawOutputAmount float64 `json:"raw_output_amount,omitempty"`
+	DecimalPlaces   int     `json:"decimal_places"`
+	Attempts        int     `json:"attempts,omitempty"`
+}
+
+func debugInfo(result Result) *Debug {
+	debug := &Debug{
+		RawInput:        result.scraped.inputValue,
+		RawOutput:       result.scraped.outputValue,
+		RawFee:          result.scraped.feeValue,
+		RawPriceImpact:  result.scraped.impactValue,
+		RawOutputAmount: result.rawOutputAmount,
+		Attempts:        result.attempts,
+	}
+	if result.Precision != nil {
+		debug.DecimalPlaces = result.Precision.Output
+	}
+	return debug
+}
+
+// Precision reports the decimal places applied to each value. The rate is
+// computed from the truncated output and not rounded again, so it carries the
+// output's precision.
+type Precision struct {
+	Input  int `json:"input"`
+	Output int `json:"output"`
+	Rate   int `json:"rate"`
+}
+
+type Fee struct {
+	Amount float64 `json:"amount,omitempty"`
+	Token  string  `json:"token,omitempty"`
+	Bps    float64 `json:"bps,omitempty"`
 }
 
 type CacheEntry struct {
 	Result    Result
+	CreatedAt time.Time
 	ExpiresAt time.Time
 }
 
+// served is the entry's result with AgeSeconds set to how long ago it was
+// stored.
+func (e CacheEntry) served() Result {
+	result := e.Result
+	if !e.CreatedAt.IsZero() {
+		result.AgeSeconds = math.Round(time.Since(e.CreatedAt).Seconds()*1000) / 1000
+	}
+	return result
+}
+
+// QuoteCache is a store of quotes by pair and cache key amount.
+type QuoteCache interface {
+	Get(inputToken, outputToken, amount string) (Result, bool)
+	Set(inputToken, outputToken, amount string, result Result)
+}
+
+// TokenPairCache is the in-memory quote cache. When remote is set (see
+// REDIS_URL) it also reads through to and writes through to it, so quotes
+// survive restarts and are shared between instances.
 type TokenPairCache struct {
-	mutex sync.RWMutex
-	cache map[string]map[string]map[string]CacheEntry
+	mutex  sync.RWMutex
+	cache  map[string]map[string]map[string]CacheEntry
+	hits   atomic.Int64
+	misses atomic.Int64
+	remote QuoteCache
+
+	// keyHits counts hits per entry, a *atomic.Int64 per entryKey, for the
+	// keepalive to find the popular ones.
+	keyHits sync.Map
+
+	recency   *lruIndex
+	evictions atomic.Int64
 }
 
 func NewTokenPairCache() *TokenPairCache {
 	return &TokenPairCache{
-		cache: make(map[string]map[string]map[string]CacheEntry),
+		cache:   make(map[string]map[string]map[string]CacheEntry),
+		recency: newLRUIndex(),
 	}
 }
 
 func (c *TokenPairCache) Get(inputToken, outputToken, amount string) (Result, bool) {
+	result, ok := c.get(inputToken, outputToken, amount)
+	if ok {
+		c.hits.Add(1)
+		if keepaliveTopK > 0 {
+			// only the keepalive reads the counts, or decays them
+			c.recordKeyHit(entryKey{inputToken, outputToken, amount})
+		}
+	} else {
+		c.misses.Add(1)
+	}
+	return result, ok
+}
+
+func (c *TokenPairCache) get(inputToken, outputToken, amount string) (Result, bool) {
+	if result, ok := c.getLocal(inputToken, outputToken, amount); ok || c.remote == nil {
+		return result, ok
+	}
+
+	result, ok := c.remote.Get(inputToken, outputToken, amount)
+	if !ok {
+		return Result{}, false
+	}
+	createdAt := quoteTime(result)
+	entry := CacheEntry{Result: result, CreatedAt: createdAt, ExpiresAt: createdAt.Add(cacheTTL)}
+	c.setLocal(inputToken, outputToken, amount, entry)
+	return entry.served(), true
+}
+
+func (c *TokenPairCache) getLocal(inputToken, outputToken, amount string) (Result, bool) {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
 
@@ -87,10 +274,42 @@ func (c *TokenPairCache) Get(inputToken, outputToken, amount string) (Result, bo
 		return Result{}, false
 	}
 
-	return entry.Result, true
+	c.recency.touch(entryKey{inputToken, outputToken, amount})
+	return entry.served(), true
+}
+
+// quoteTime is when result was scraped, or now when its timestamp is unknown.
+func quoteTime(result Result) time.Time {
+	if scrapedAt, err := time.Parse(time.RFC3339, result.Timestamp); err == nil {
+		return scrapedAt
+	}
+	return time.Now()
+}
+
+// GetEntry returns the stored entry even when it has expired.
+func (c *TokenPairCache) GetEntry(inputToken, outputToken, amount string) (CacheEntry, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	entry, ok := c.cache[inputToken][outputToken][amount]
+	return entry, ok
 }
 
 func (c *TokenPairCache) Set(inputToken, outputToken, amount string, result Result) {
+	now := time.Now()
+	stored := c.setLocal(inputToken, outputToken, amount, CacheEntry{
+		Result:    result,
+		CreatedAt: now,
+		ExpiresAt: now.Add(cacheTTL),
+	})
+	if stored && c.remote != nil {
+		c.remote.Set(inputToken, outputToken, amount, result)
+	}
+}
+
+// setLocal stores entry unless a newer quote is already cached and reports
+// whether it did.
+func (c *TokenPairCache) setLocal(inputToken, outputToken, amount string, entry CacheEntry) bool {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
@@ -102,221 +321,931 @@ func (c *TokenPairCache) Set(inputToken, outputToken, amount string, result Resu
 		c.cache[inputToken][outputToken] = make(map[string]CacheEntry)
 	}
 
-	c.cache[inputToken][outputToken][amount] = CacheEntry{
-		Result:    result,
-		ExpiresAt: time.Now().Add(CACHE_TTL),
+	if existing, ok := c.cache[inputToken][outputToken][amount]; ok && newerResult(existing.Result, entry.Result) {
+		// a concurrent scrape that finished later already stored a fresher quote
+		return false
 	}
-}
-
-var cache = NewTokenPairCache()
 
-func fetchTokenPrice(inputToken, outputToken, amount, targetURL string) (Result, error) {
-	const maxRetries = 3
-	var inputAmount, outputAmount float64
-	var err error
+	c.cache[inputToken][outputToken][amount] = entry
+	c.recency.touch(entryKey{inputToken, outputToken, amount})
+	c.evictOverflowLocked()
+	return true
+}
 
-	for attempt := 1; attempt <= maxRetries; attempt++ {
-		log.Printf("Attempt %d of %d for %s to %s (amount: %s)", attempt, maxRetries, inputToken, outputToken, amount)
+// newerResult reports whether a was quoted after b. Timestamps only have
+// second resolution, so ties are broken by sequence number.
+func newerResult(a, b Result) bool {
+	aTime, aErr := time.Parse(time.RFC3339, a.Timestamp)
+	bTime, bErr := time.Parse(time.RFC3339, b.Timestamp)
+	if aErr != nil || bErr != nil {
+		return false
+	}
+	if !aTime.Equal(bTime) {
+		return aTime.After(bTime)
+	}
+	return a.Sequence > b.Sequence && b.Sequence != 0
+}
 
-		opts := append(chromedp.DefaultExecAllocatorOptions[:],
-			chromedp.Flag("headless", true),
-			chromedp.Flag("disable-gpu", true),
-			chromedp.Flag("no-sandbox", true),
-			chromedp.Flag("disable-dev-shm-usage", true),
-		)
+// Len counts the stored entries, expired ones included.
+func (c *TokenPairCache) Len() int {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
 
-		allocCtx, cancel := chromedp.NewExecAllocator(context.Background(), opts...)
-		ctx, cancel2 := chromedp.NewContext(allocCtx, chromedp.WithLogf(log.Printf))
-		ctx, cancel3 := context.WithTimeout(ctx, 30*time.Second)
-
-		var inputValue, outputValue string
-
-		err = chromedp.Run(ctx,
-			chromedp.Navigate(targetURL),
-			chromedp.WaitVisible(`input[data-sentry-element="Input"]`, chromedp.ByQuery),
-			chromedp.Clear(`input[data-sentry-element="Input"]`, chromedp.ByQuery),
-			chromedp.SendKeys(`input[data-sentry-element="Input"]`, amount, chromedp.ByQuery),
-			chromedp.Sleep(5*time.Second),
-			chromedp.Value(`input[data-sentry-element="Input"]`, &inputValue, chromedp.ByQuery),
-			chromedp.Evaluate(`Array.from(document.querySelectorAll('input[data-sentry-element="Input"]')).filter(el => el.placeholder === "0.00")[1]?.value || "0"`, &outputValue),
-			chromedp.ActionFunc(func(ctx context.Context) error {
-				if outputValue == "0" || outputValue == "" {
-					var result string
-					err := chromedp.Evaluate(`document.querySelector('div[data-sentry-component="SwapInput"]:nth-of-type(2) input[data-sentry-element="Input"]').value`, &result).Do(ctx)
-					if err == nil && result != "" {
-						outputValue = result
-					}
-				}
-				return nil
-			}),
-		)
+	count := 0
+	for _, outputs := range c.cache {
+		for _, amounts := range outputs {
+			count += len(amounts)
+		}
+	}
+	return count
+}
 
-		cancel3()
-		cancel2()
-		cancel()
+// EvictToken removes every entry quoting token as either input or output and
+// returns how many were removed.
+func (c *TokenPairCache) EvictToken(token string) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 
-		if err != nil {
-			log.Printf("Error in attempt %d: %v", attempt, err)
-			if attempt < maxRetries {
-				time.Sleep(2 * time.Second)
+	var keys []entryKey
+	for inputToken, outputs := range c.cache {
+		for outputToken, amounts := range outputs {
+			if inputToken != token && outputToken != token {
 				continue
 			}
-			return Result{}, err
+			for amount := range amounts {
+				keys = append(keys, entryKey{inputToken, outputToken, amount})
+			}
 		}
+	}
+	for _, key := range keys {
+		c.deleteLocked(key)
+	}
+	return len(keys)
+}
 
-		inputValue = strings.TrimSpace(inputValue)
-		outputValue = strings.TrimSpace(outputValue)
+func (c *TokenPairCache) Counters() (hits, misses int64) {
+	return c.hits.Load(), c.misses.Load()
+}
 
-		inputAmount, err = strconv.ParseFloat(inputValue, 64)
-		if err != nil {
-			log.Printf("Error parsing input value in attempt %d: %v", attempt, err)
-			if attempt < maxRetries {
-				time.Sleep(2 * time.Second)
-				continue
-			}
-			return Result{}, err
-		}
+// Expired counts entries past their TTL that the sweeper hasn't removed yet.
+func (c *TokenPairCache) Expired() int {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
 
-		outputAmount, err = strconv.ParseFloat(outputValue, 64)
-		if err != nil {
-			log.Printf("Error parsing output value in attempt %d: %v", attempt, err)
-			if attempt < maxRetries {
-				time.Sleep(2 * time.Second)
-				continue
+	now := time.Now()
+	count := 0
+	for _, outputs := range c.cache {
+		for _, amounts := range outputs {
+			for _, entry := range amounts {
+				if now.After(entry.ExpiresAt) {
+					count++
+				}
 			}
-			return Result{}, err
 		}
-		if (inputAmount == outputAmount && inputToken != outputToken) || outputAmount == 0 {
-			log.Printf("Invalid result detected in attempt %d. Input: %f, Output: %f",
-				attempt, inputAmount, outputAmount)
-			if attempt < maxRetries {
-				time.Sleep(2 * time.Second)
-				continue
-			}
-			return Result{}, fmt.Errorf("invalid conversion result: same input/output amount or zero output")
+	}
+	return count
+}
+
+// Flush removes every local entry and returns how many there were.
+func (c *TokenPairCache) Flush() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	removed := 0
+	for _, outputs := range c.cache {
+		for _, amounts := range outputs {
+			removed += len(amounts)
 		}
-		//valid result
-		break
-	}
-
-	var decimalPlaces int
-	switch outputToken {
-	case "lbtc":
-		decimalPlaces = 8
-	case "usdc":
-		decimalPlaces = 2
-	case "usdt":
-		decimalPlaces = 2
-	case "eth":
-		decimalPlaces = 5
-	case "wbtc":
-		decimalPlaces = 8
-	default:
-		decimalPlaces = 2
 	}
+	c.cache = make(map[string]map[string]map[string]CacheEntry)
+	c.recency.reset()
+	c.keyHits.Clear()
+	return removed
+}
+
+var cache = NewTokenPairCache()
 
-	factor := math.Pow10(decimalPlaces)
-	outputAmount = math.Floor(outputAmount*factor) / factor
+var (
+	listenPort = envString("PORT", DEFAULT_PORT)
+	cacheTTL   = envDuration("CACHE_TTL", DEFAULT_CACHE_TTL)
+)
 
-	exchangeRate := outputAmount / inputAmount
+// maxRequestTimeout, MAX_REQUEST_TIMEOUT, caps the ?timeout= a client may ask
+// to wait for a quote. Past it the scrape is abandoned and its browser slot
+// freed.
+var maxRequestTimeout = envDuration("MAX_REQUEST_TIMEOUT", 60*time.Second)
 
-	result := Result{
-		Input: struct {
-			Amount float64 `json:"amount"`
-			Token  string  `json:"token"`
-		}{
-			Amount: inputAmount,
-			Token:  inputToken,
-		},
-		Output: struct {
-			Amount float64 `json:"amount"`
-			Token  string  `json:"token"`
-		}{
-			Amount: outputAmount,
-			Token:  outputToken,
-		},
-		ExchangeRate: exchangeRate,
-		Timestamp:    time.Now().Format(time.RFC3339),
+func parseRequestTimeout(value string) (time.Duration, error) {
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("timeout must be a positive duration such as 5s")
 	}
+	return min(timeout, maxRequestTimeout), nil
+}
+
+// defaultOutputToken is quoted against when the output parameter is omitted.
+var defaultOutputToken = envString("DEFAULT_OUTPUT_TOKEN", "usdc")
 
-	return result, nil
+// quoteParam reads a pair parameter from the /price/:input/:output/:amount
+// path, falling back to the query string of the / route.
+func quoteParam(c *gin.Context, name string) string {
+	if value := c.Param(name); value != "" {
+		return value
+	}
+	return c.Query(name)
+}
+
+// splitPair reads pair shorthand such as "mon-usdc" or "MON/USDC" as input and
+// output tokens.
+func splitPair(pair string) (string, string, error) {
+	separator := "/"
+	if !strings.Contains(pair, separator) {
+		separator = "-"
+	}
+	inputToken, outputToken, found := strings.Cut(pair, separator)
+	inputToken, outputToken = strings.TrimSpace(inputToken), strings.TrimSpace(outputToken)
+	if !found || inputToken == "" || outputToken == "" || strings.ContainsAny(outputToken, "/-") {
+		return "", "", fmt.Errorf("pair must look like input/output or input-output, got %q", pair)
+	}
+	return strings.ToLower(inputToken), strings.ToLower(outputToken), nil
 }
 
 func handleTokenPrice(c *gin.Context) {
-	startTime := time.Now()
+	inputToken := quoteParam(c, "input")
+	outputToken := quoteParam(c, "output")
+	amount := quoteParam(c, "amount")
+	if pair := c.Query("pair"); pair != "" {
+		var err error
+		if inputToken, outputToken, err = splitPair(pair); err != nil {
+			respondError(c, http.StatusBadRequest, CODE_INVALID_PARAMETER, err.Error())
+			return
+		}
+	}
+	if outputToken == "" {
+		outputToken = defaultOutputToken
+	}
 
-	inputToken := c.Query("input")
-	outputToken := c.Query("output")
-	amount := c.Query("amount")
+	mode := c.DefaultQuery("mode", "quote")
+	if mode != "quote" && mode != "spot" {
+		respondError(c, http.StatusBadRequest, CODE_INVALID_PARAMETER, "mode must be quote or spot")
+		return
+	}
+	side := c.DefaultQuery("side", SIDE_INPUT)
+	if side != SIDE_INPUT && side != SIDE_OUTPUT {
+		respondError(c, http.StatusBadRequest, CODE_INVALID_PARAMETER, "side must be input or output")
+		return
+	}
+	if side == SIDE_OUTPUT && mode == "spot" {
+		respondError(c, http.StatusBadRequest, CODE_INVALID_PARAMETER, "side=output does not apply to mode=spot")
+		return
+	}
 
-	if inputToken == "" || outputToken == "" || amount == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "input, output, and amount parameters are required"})
+	if inputToken == "" || outputToken == "" || (amount == "" && mode != "spot") {
+		respondError(c, http.StatusBadRequest, CODE_INVALID_PARAMETER, "input and amount parameters are required")
 		return
 	}
 
-	var fromAddress, toAddress string
-	var exists bool
+	var inputAddress, outputAddress string
+	if common.IsHexAddress(inputToken) {
+		if symbol, ok := symbolForAddress(inputToken); ok {
+			inputAddress, inputToken = inputToken, symbol
+		}
+	}
+	if common.IsHexAddress(outputToken) {
+		if symbol, ok := symbolForAddress(outputToken); ok {
+			outputAddress, outputToken = outputToken, symbol
+		}
+	}
+
+	inputToken, outputToken = normalizeToken(inputToken), normalizeToken(outputToken)
+
+	if _, exists := tokenAddresses[inputToken]; !exists {
+		respondError(c, http.StatusBadRequest, CODE_UNSUPPORTED_TOKEN, "unsupported input token: "+inputToken)
+		return
+	}
 
-	fromAddress, exists = tokenAddresses[inputToken]
-	if !exists {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported input token: " + inputToken})
+	if _, exists := tokenAddresses[outputToken]; !exists {
+		respondError(c, http.StatusBadRequest, CODE_UNSUPPORTED_TOKEN, "unsupported output token: "+outputToken)
 		return
 	}
 
-	toAddress, exists = tokenAddresses[outputToken]
-	if !exists {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported output token: " + outputToken})
+	if sameToken(inputToken, outputToken) {
+		respondError(c, http.StatusBadRequest, CODE_INVALID_PARAMETER, errSameToken.Error())
 		return
 	}
 
-	if cachedResult, found := cache.Get(inputToken, outputToken, amount); found {
-		if (cachedResult.Input.Amount == cachedResult.Output.Amount &&
-			cachedResult.Input.Token != cachedResult.Output.Token) ||
-			cachedResult.Output.Amount == 0 {
-			log.Printf("[CACHE INVALID] Invalid cached result detected, fetching fresh data")
-		} else {
-			duration := time.Since(startTime)
-			log.Printf("[CACHE HIT] Request processed in %v", duration)
-			c.JSON(http.StatusOK, cachedResult)
+	// on side=output the amount is in the output token
+	amountToken := inputToken
+	if side == SIDE_OUTPUT {
+		amountToken = outputToken
+	}
+
+	amountUnit := c.DefaultQuery("amount_unit", "decimal")
+	weiAmount := ""
+	switch amountUnit {
+	case "decimal":
+	case "wei":
+		decimalAmount, err := weiToDecimal(amount, tokenChainDecimals[amountToken])
+		if err != nil {
+			respondError(c, http.StatusBadRequest, CODE_INVALID_AMOUNT, err.Error())
 			return
 		}
+		weiAmount, amount = amount, decimalAmount
+	default:
+		respondError(c, http.StatusBadRequest, CODE_INVALID_PARAMETER, "amount_unit must be decimal or wei")
+		return
+	}
+
+	if mode == "spot" {
+		amount, weiAmount = spotAmount(inputToken), ""
+	}
+
+	amount = canonicalAmount(amount)
+	if err := validateAmount(amountToken, amount); err != nil {
+		respondError(c, http.StatusBadRequest, CODE_INVALID_AMOUNT, err.Error())
+		return
+	}
+	requestedAmount := amount
+	amount, err := fitAmountLength(amount)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, CODE_INVALID_AMOUNT, err.Error())
+		return
+	}
+
+	priority, err := parsePriority(c.GetHeader("X-Priority"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, CODE_INVALID_PARAMETER, err.Error())
+		return
+	}
+	options, err := parseResultOptions(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, CODE_INVALID_PARAMETER, err.Error())
+		return
+	}
+
+	addLogFields(c, "input", inputToken, "output", outputToken, "amount", amount, "side", side)
+	fresh := alwaysFreshPairs[pairKey(inputToken, outputToken)] || wantsFresh(c)
+	quoteCtx := withPriority(c.Request.Context(), priority)
+	var timeout time.Duration
+	if timeoutParam := c.Query("timeout"); timeoutParam != "" {
+		if timeout, err = parseRequestTimeout(timeoutParam); err != nil {
+			respondError(c, http.StatusBadRequest, CODE_INVALID_PARAMETER, err.Error())
+			return
+		}
+		var cancel context.CancelFunc
+		quoteCtx, cancel = context.WithTimeout(quoteCtx, timeout)
+		defer cancel()
+	}
+	linear := c.Query("linear") == "true"
+	keyAmount := amount
+	if linear || linearScalingPairs[pairKey(inputToken, outputToken)] {
+		keyAmount = linearBaseAmount
+	}
+	if side == SIDE_INPUT {
+		c.Header("X-Cache-Key", storedCacheKey(inputToken, outputToken, keyAmount))
+	}
+
+	noStale := c.Query("no_stale") == "true"
+
+	reverse := c.Query("reverse")
+	var waitReverse func() *Result
+	switch reverse {
+	case "", "false", "reciprocal":
+	case "true":
+		reverseAmount := canonicalAmount(c.DefaultQuery("reverse_amount", UNIT_AMOUNT))
+		err := validateAmount(outputToken, reverseAmount)
+		if err == nil {
+			reverseAmount, err = fitAmountLength(reverseAmount)
+		}
+		if err != nil {
+			respondError(c, http.StatusBadRequest, CODE_INVALID_AMOUNT, "reverse_amount: "+err.Error())
+			return
+		}
+		// quoted alongside the forward direction rather than after it
+		waitReverse = startReverseQuote(quoteCtx, inputToken, outputToken, reverseAmount, fresh)
+	default:
+		respondError(c, http.StatusBadRequest, CODE_INVALID_PARAMETER, "reverse must be true, false or reciprocal")
+		return
 	}
 
-	targetURL := fmt.Sprintf("https://kuru.io/swap?from=%s&to=%s", fromAddress, toAddress)
-	result, err := fetchTokenPrice(inputToken, outputToken, amount, targetURL)
+	var result Result
+	var cached bool
+	if side == SIDE_OUTPUT {
+		result, err = getExactOutputQuote(quoteCtx, inputToken, outputToken, amount)
+	} else if staleResult, ok := serveStale(inputToken, outputToken, amount, fresh || noStale); ok {
+		result, cached = staleResult, true
+	} else if mode == "spot" {
+		result, cached, err = getSpotQuote(quoteCtx, inputToken, outputToken, amount, fresh)
+	} else if c.Query("autosize") == "true" {
+		result, cached, err = getQuoteAutosized(quoteCtx, inputToken, outputToken, amount, fresh)
+	} else if linear {
+		// an opt-in ballpark, flagged as such unlike the configured pairs
+		result, cached, err = getScaledQuote(quoteCtx, inputToken, outputToken, amount, fresh)
+		result.Estimated = result.ScaledFrom != 0
+	} else if linearScalingPairs[pairKey(inputToken, outputToken)] {
+		result, cached, err = getScaledQuote(quoteCtx, inputToken, outputToken, amount, fresh)
+	} else {
+		result, cached, err = resolveQuote(quoteCtx, inputToken, outputToken, amount, fresh)
+	}
+	if c.Request.Context().Err() != nil {
+		// the client is gone, there is nobody to serve a fallback to
+		c.AbortWithStatusJSON(STATUS_CLIENT_CLOSED_REQUEST, gin.H{
+			"error": "request cancelled: " + c.Request.Context().Err().Error(),
+			"code":  CODE_REQUEST_CANCELLED,
+		})
+		return
+	}
+	if err != nil && timeout > 0 && errors.Is(quoteCtx.Err(), context.DeadlineExceeded) {
+		// the client capped the wait, a fallback would only add to it
+		err = &QuoteError{Code: CODE_UPSTREAM_TIMEOUT, Err: fmt.Errorf("no quote within the requested timeout of %v", timeout)}
+	} else if err != nil && side == SIDE_INPUT {
+		// the fallbacks answer for an input amount
+		result, err = applyFallbacks(inputToken, outputToken, amount, err, !noStale)
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
+		code := errorCode(err)
+		status, message := errorStatus(code), err.Error()
+		if noStale && status == http.StatusInternalServerError {
+			status, message = http.StatusServiceUnavailable, "no fresh quote available: "+message
+		}
+		respondError(c, status, code, message)
+		return
+	}
+
+	if amount != requestedAmount && result.RequestedAmount == 0 {
+		result.RequestedAmount, _ = strconv.ParseFloat(requestedAmount, 64)
+	}
+	result.InputAddress, result.OutputAddress = inputAddress, outputAddress
+	result.Stale = result.Stale || isStale(result)
+	result.Confidence = confidence(result)
+	if noStale && result.Stale {
+		respondError(c, http.StatusServiceUnavailable, CODE_STALE_QUOTE, "no fresh quote available, the latest is older than "+staleAfter.String())
+		return
+	}
+	result.NormalizedRate = normalizedRate(result, c.Query("normalized") == "true")
+	if c.Query("slippage") == "true" {
+		result.EffectiveSlippageBps = effectiveSlippageBps(result)
+	}
+	if c.Query("with_usd") == "true" {
+		inputAmount := amount
+		if side == SIDE_OUTPUT {
+			inputAmount = strconv.FormatFloat(result.Input.Amount, 'f', -1, 64)
+		}
+		result.InputUSDValue = inputUSDValue(inputToken, outputToken, inputAmount, result)
+	}
+	if mode == "spot" {
+		result.Mode, result.SpotPrice = mode, spotPrice(result)
+	}
+	if c.Query("usd") == "true" {
+		result.OutputUSD = outputUSDValue(quoteCtx, outputToken, result)
+	}
+	if weiAmount != "" {
+		result.InputWei = decimalToWei(result.Input.Amount, tokenChainDecimals[inputToken])
+		result.OutputWei = decimalToWei(result.Output.Amount, tokenChainDecimals[outputToken])
+	}
+	if c.Query("debug") == "true" {
+		result.Debug = debugInfo(result)
+	}
+	if waitReverse != nil {
+		result.Reverse = waitReverse()
+	} else if reverse == "reciprocal" {
+		result.ReciprocalRate = reciprocalRate(result)
+	}
+
+	c.Set(CACHE_HIT_KEY, cached)
+
+	addLogFields(c, "source", result.Source)
+	if notModified(c, result) {
 		return
 	}
+	writeResult(c, result, options)
+}
+
+var errInvalidResult = errors.New("invalid conversion result: same input/output amount or zero output")
 
-	if (result.Input.Amount == result.Output.Amount &&
+func isInvalidResult(result Result) bool {
+	return (result.Input.Amount == result.Output.Amount &&
 		result.Input.Token != result.Output.Token) ||
-		result.Output.Amount == 0 {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "invalid conversion result: same input/output amount or zero output"})
+		result.Output.Amount == 0
+}
+
+// getQuote serves a quote from the cache when a valid entry exists and scrapes
+// kuru otherwise. The bool reports whether the result came from the cache.
+func getQuote(inputToken, outputToken, amount string) (Result, bool, error) {
+	return resolveQuote(context.Background(), inputToken, outputToken, amount, false)
+}
+
+// resolveQuote is getQuote with the option to skip the cache lookup. ctx
+// carries the request's priority and ID to the scrape. A fresh result is still
+// written back to the cache.
+func resolveQuote(ctx context.Context, inputToken, outputToken, amount string, fresh bool) (Result, bool, error) {
+	key := cacheKeyAmount(amount)
+
+	if !fresh && rateCached(inputToken, outputToken) {
+		if rateResult, found := rateCache.Quote(inputToken, outputToken, amount); found {
+			rateResult.Source = "cache"
+			return rateResult, true, nil
+		}
+	}
+	if !fresh {
+		if cachedResult, found := cache.Get(inputToken, outputToken, key); found {
+			if isInvalidResult(cachedResult) {
+				log.Printf("[CACHE INVALID] Invalid cached result detected, fetching fresh data")
+			} else {
+				cachedResult.Source = "cache"
+				return cachedResult, true, nil
+			}
+		}
+	}
+
+	if recentResult, found := throttle.Recent(inputToken, outputToken, key); found {
+		log.Printf("[THROTTLED] %s to %s scraped within %v, serving last result", inputToken, outputToken, minScrapeInterval)
+		recentResult.Source = "cache"
+		return recentResult, true, nil
+	}
+
+	if negativeCachingEnabled() && negativeCache.Failed(inputToken, outputToken, key) {
+		return Result{}, false, errNegativelyCached
+	}
+	if maintenanceMode.Load() {
+		return Result{}, false, errMaintenance
+	}
+
+	// concurrent misses for the same key share one scrape, which runs until
+	// the last request waiting on it is done or gone
+	flightKey := cacheKey(inputToken, outputToken, amount)
+	flightCtx, leave := joinFlight(ctx, flightKey)
+	defer leave()
+	flight := scrapeGroup.DoChan(flightKey, func() (result interface{}, err error) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				err = fmt.Errorf("scrape panicked: %v", recovered)
+			}
+		}()
+
+		fetched, err := priceSource.Fetch(flightCtx, inputToken, outputToken, amount)
+		if err != nil {
+			return nil, err
+		}
+
+		if isInvalidResult(fetched) {
+			return nil, errInvalidResult
+		}
+
+		storeQuote(inputToken, outputToken, key, fetched)
+		return fetched, nil
+	})
+
+	var outcome singleflight.Result
+	select {
+	case outcome = <-flight:
+	case <-ctx.Done():
+		return Result{}, false, ctx.Err()
+	}
+	if outcome.Err != nil {
+		return Result{}, false, outcome.Err
+	}
+	if outcome.Shared {
+		log.Printf("[SINGLEFLIGHT] Shared one scrape of %s", flightKey)
+	}
+
+	return outcome.Val.(Result), false, nil
+}
+
+var scrapeGroup singleflight.Group
+
+// cacheKeyDecimals caps how many fractional digits of the amount take part in
+// the cache key. The full amount is still typed into kuru, but amounts that
+// only differ beyond the cap share a cache entry: the first one scraped is
+// served for all of them. That is a deliberate trade of a negligible price
+// difference for not filling the cache with one-off keys.
+var cacheKeyDecimals = envInt("CACHE_KEY_DECIMALS", 8)
+
+func cacheKeyAmount(amount string) string {
+	amount = canonicalAmount(amount)
+	whole, fraction, found := strings.Cut(amount, ".")
+	if !found || len(fraction) <= cacheKeyDecimals || cacheKeyDecimals < 0 {
+		return amount
+	}
+	fraction = strings.TrimRight(fraction[:cacheKeyDecimals], "0")
+	if fraction == "" {
+		return whole
+	}
+	return whole + "." + fraction
+}
+
+var plainDecimalPattern = regexp.MustCompile(`^(\d+\.?\d*|\.\d+)$`)
+
+// canonicalAmount rewrites a plain decimal amount without leading or
+// trailing zeros, so "1", "1.0" and "01.00" are the same amount. Anything
+// else is returned unchanged and left for validation to reject.
+func canonicalAmount(amount string) string {
+	if !plainDecimalPattern.MatchString(amount) {
+		return amount
+	}
+	whole, fraction, _ := strings.Cut(amount, ".")
+	whole = strings.TrimLeft(whole, "0")
+	if whole == "" {
+		whole = "0"
+	}
+	fraction = strings.TrimRight(fraction, "0")
+	if fraction == "" {
+		return whole
+	}
+	return whole + "." + fraction
+}
+
+// cacheKey is the key a quote is cached under, after aliasing and amount
+// bucketing, as exposed in the X-Cache-Key header.
+func cacheKey(inputToken, outputToken, amount string) string {
+	return pairKey(inputToken, outputToken) + "/" + cacheKeyAmount(amount)
+}
+
+func storeQuote(inputToken, outputToken, amount string, result Result) {
+	if rateCached(inputToken, outputToken) {
+		rateCache.Set(inputToken, outputToken, result)
+	} else {
+		cache.Set(inputToken, outputToken, amount, result)
+	}
+	freshness.Touch(inputToken, outputToken)
+	throttle.Record(inputToken, outputToken, amount, result)
+	quoteHistory.Record(inputToken, outputToken, amount, result)
+	publishQuote(inputToken, outputToken, result)
+}
+
+const UNIT_AMOUNT = "1"
+
+// normalizedRate returns the output received for exactly one input token. It
+// differs from ExchangeRate for large amounts because of price impact. The
+// unit quote is taken from the cache when available and only scraped when the
+// caller explicitly asks for it; without one the rate is 0, and so omitted.
+func normalizedRate(result Result, fetch bool) float64 {
+	if result.Input.Amount == 1 {
+		return result.ExchangeRate
+	}
+
+	inputToken, outputToken := result.Input.Token, result.Output.Token
+	if unitResult, found := cache.get(inputToken, outputToken, UNIT_AMOUNT); found && !isInvalidResult(unitResult) {
+		return unitResult.ExchangeRate
+	}
+	if !fetch {
+		return 0
+	}
+
+	unitResult, _, err := getQuote(inputToken, outputToken, UNIT_AMOUNT)
+	if err != nil {
+		log.Printf("[NORMALIZED] Failed to fetch unit quote for %s to %s: %v", inputToken, outputToken, err)
+		return 0
+	}
+	return unitResult.ExchangeRate
+}
+
+// alwaysFreshPairs lists "input/output" pairs from ALWAYS_FRESH_PAIRS (comma
+// separated) that handleTokenPrice always scrapes live, e.g. volatile pairs
+// where a cached quote is never acceptable.
+var alwaysFreshPairs = parsePairSet(envString("ALWAYS_FRESH_PAIRS", ""))
+
+// wantsFresh reports whether the client asked to skip the cache, with
+// ?fresh=true or Cache-Control: no-cache. Such a request always waits for a
+// scrape; the fresh quote is still cached for everyone else.
+func wantsFresh(c *gin.Context) bool {
+	if c.Query("fresh") == "true" {
+		return true
+	}
+	for _, directive := range strings.Split(c.GetHeader("Cache-Control"), ",") {
+		if strings.EqualFold(strings.TrimSpace(directive), "no-cache") {
+			return true
+		}
+	}
+	return false
+}
+
+func parsePairSet(value string) map[string]bool {
+	pairs := make(map[string]bool)
+	for _, pair := range strings.Split(value, ",") {
+		if pair = strings.ToLower(strings.TrimSpace(pair)); pair != "" {
+			pairs[pair] = true
+		}
+	}
+	return pairs
+}
+
+// staleAfter is the soft age threshold past which a served quote is flagged
+// stale even though it is still inside CACHE_TTL. Clients can use the flag to
+// decide whether to ask for a fresh one.
+var staleAfter = envDuration("STALE_AFTER", 2*time.Minute)
+
+func isStale(result Result) bool {
+	if staleAfter <= 0 {
+		return false
+	}
+	scrapedAt, err := time.Parse(time.RFC3339, result.Timestamp)
+	if err != nil {
+		return false
+	}
+	return time.Since(scrapedAt) > staleAfter
+}
+
+var usdBaseToken = envString("USD_BASE_TOKEN", "usdc")
+
+// inputUSDValue prices the requested input amount in the USD base token,
+// reusing the main quote when it is already against that token.
+func inputUSDValue(inputToken, outputToken, amount string, result Result) float64 {
+	if inputToken == usdBaseToken {
+		return result.Input.Amount
+	}
+	if outputToken == usdBaseToken {
+		return result.Output.Amount
+	}
+
+	usdResult, _, err := getQuote(inputToken, usdBaseToken, amount)
+	if err != nil {
+		log.Printf("[USD] Failed to price %s in %s: %v", inputToken, usdBaseToken, err)
+		return 0
+	}
+	return usdResult.Output.Amount
+}
+
+// usdPeggedTokens are taken at face value rather than quoted against
+// USD_BASE_TOKEN.
+var usdPeggedTokens = map[string]bool{"usdc": true, "usdt": true}
+
+// outputUSDValue prices the quote's output in the USD base token. The
+// conversion leg is quoted for one unit and scaled, so it is cached once per
+// token instead of once per output amount.
+func outputUSDValue(ctx context.Context, outputToken string, result Result) float64 {
+	if outputToken == usdBaseToken || usdPeggedTokens[outputToken] {
+		return result.Output.Amount
+	}
+
+	usdResult, _, err := resolveQuote(ctx, outputToken, usdBaseToken, UNIT_AMOUNT, false)
+	if err != nil {
+		loggerFrom(ctx).Warn("usd conversion failed",
+			"input", outputToken,
+			"output", usdBaseToken,
+			"error", err,
+		)
+		return 0
+	}
+	return result.Output.Amount * usdResult.ExchangeRate
+}
+
+var autosizeMaxSteps = envInt("AUTOSIZE_MAX_STEPS", 6)
+
+// getQuoteAutosized halves the amount after each failed quote (typically
+// insufficient liquidity or extreme price impact) and returns the largest
+// amount that produced a valid quote.
+func getQuoteAutosized(ctx context.Context, inputToken, outputToken, amount string, fresh bool) (Result, bool, error) {
+	result, cached, err := resolveQuote(ctx, inputToken, outputToken, amount, fresh)
+	if err == nil {
+		return result, cached, nil
+	}
+
+	requested, parseErr := strconv.ParseFloat(amount, 64)
+	if parseErr != nil || requested <= 0 {
+		return Result{}, false, err
+	}
+
+	size := requested
+	for step := 1; step <= autosizeMaxSteps; step++ {
+		size /= 2
+		candidate := strconv.FormatFloat(size, 'f', -1, 64)
+		log.Printf("[AUTOSIZE] Quote failed for %s to %s, retrying with amount %s (step %d of %d)",
+			inputToken, outputToken, candidate, step, autosizeMaxSteps)
+
+		result, cached, stepErr := resolveQuote(ctx, inputToken, outputToken, candidate, fresh)
+		if stepErr == nil {
+			result.RequestedAmount = requested
+			return result, cached, nil
+		}
+	}
+
+	return Result{}, false, err
+}
+
+// ResultOptions are the presentation parameters of a quote request, parsed
+// before anything is scraped so a typo in one costs no scrape.
+type ResultOptions struct {
+	Version   int
+	Callback  string
+	Rounding  string
+	Decimals  int // -1 for the token's default
+	SigFigs   int // 0 to leave the rounding to Decimals
+	Canonical bool
+}
+
+func parseResultOptions(c *gin.Context) (ResultOptions, error) {
+	options := ResultOptions{Decimals: -1, Canonical: c.Query("canonical") == "true"}
+
+	version, ok := parseSchemaVersion(c.GetHeader("Accept-Version"))
+	if !ok {
+		return options, fmt.Errorf("unsupported Accept-Version, latest is %d", SCHEMA_VERSION)
+	}
+	options.Version = version
+
+	options.Callback = c.Query("callback")
+	if options.Callback != "" && !jsonpCallbackPattern.MatchString(options.Callback) {
+		return options, errors.New("callback must be a valid JavaScript identifier")
+	}
+
+	var err error
+	if options.Rounding, err = parseRounding(c.DefaultQuery("rounding", ROUNDING_FLOOR)); err != nil {
+		return options, err
+	}
+	if decimalsParam := c.Query("decimals"); decimalsParam != "" {
+		if options.Decimals, err = parseDecimals(decimalsParam); err != nil {
+			return options, err
+		}
+	}
+	if sigFigsParam := c.Query("sig_figs"); sigFigsParam != "" {
+		if options.SigFigs, err = parseSigFigs(sigFigsParam); err != nil {
+			return options, err
+		}
+	}
+	return options, nil
+}
+
+func writeResult(c *gin.Context, result Result, options ResultOptions) {
+	if options.Decimals >= 0 {
+		result = applyDecimals(result, options.Decimals, options.Rounding)
+	} else if options.Rounding != ROUNDING_FLOOR {
+		result = applyDecimals(result, outputDecimals(result), options.Rounding)
+	}
+	if options.SigFigs > 0 {
+		result = applySigFigs(result, options.SigFigs)
+	}
+
+	result = applyRatePresentation(result)
+
+	if options.Canonical {
+		result = canonicalize(result)
+	}
+	result = signResult(result)
+	auditQuote(c, result)
+
+	if strings.Contains(c.GetHeader("Accept"), PROTOBUF_CONTENT_TYPE) {
+		c.Header("X-Schema-Version", strconv.Itoa(SCHEMA_VERSION))
+		c.Data(http.StatusOK, PROTOBUF_CONTENT_TYPE, marshalResultProto(result))
 		return
 	}
 
-	cache.Set(inputToken, outputToken, amount, result)
+	body, err := shapeResult(result, options.Version)
+	if err != nil {
+		code := errorCode(err)
+		respondError(c, errorStatus(code), code, err.Error())
+		return
+	}
+	c.Header("X-Schema-Version", strconv.Itoa(options.Version))
 
-	duration := time.Since(startTime)
-	log.Printf("[CACHE MISS] Request processed in %v", duration)
+	if options.Callback != "" {
+		c.JSONP(http.StatusOK, body)
+		return
+	}
+	c.JSON(http.StatusOK, body)
+}
+
+var jsonpCallbackPattern = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*(\.[A-Za-z_$][A-Za-z0-9_$]*)*$`)
+
+// canonicalize orders the pair by token address (symbol as a tie-breaker for
+// tokens sharing an address) so the same pair is always stored the same way.
+func canonicalize(result Result) Result {
+	inputKey := strings.ToLower(tokenAddresses[result.Input.Token]) + result.Input.Token
+	outputKey := strings.ToLower(tokenAddresses[result.Output.Token]) + result.Output.Token
+	if inputKey <= outputKey {
+		result.QuotedDirection = "forward"
+		return result
+	}
 
-	c.JSON(http.StatusOK, result)
+	result.Input, result.Output = result.Output, result.Input
+	result.InputAddress, result.OutputAddress = result.OutputAddress, result.InputAddress
+	if result.Precision != nil {
+		precision := *result.Precision
+		precision.Input, precision.Output = precision.Output, precision.Input
+		result.Precision = &precision
+	}
+	// the display rate is configured for the quoted direction only
+	result.DisplayRate, result.DisplayRateUnit = 0, ""
+	result.ExchangeRate = exchangeRate(result.Output.Amount, result.Input.Amount)
+	if result.GrossExchangeRate != 0 {
+		result.GrossExchangeRate = 1 / result.GrossExchangeRate
+	}
+	if result.ReciprocalRate != 0 {
+		result.ReciprocalRate = reciprocalRate(result)
+	}
+	result.QuotedDirection = "reverse"
+	return result
 }
 
 func setupRouter() *gin.Engine {
-	router := gin.Default()
+	router := gin.New()
+	router.Use(logRequests, gin.Recovery(), cors, requestIDMiddleware, gzipResponses, metricsMiddleware, rateLimit, simulateLatency)
 	router.GET("/", handleTokenPrice)
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	router.GET("/price/:input/:output/:amount", handleTokenPrice)
+	protected := router.Group("/", requireAPIKey)
+	protected.POST("/basket", handleBasket)
+	protected.POST("/batch", handleBatchPrice)
+	protected.GET("/multi", handleMultiOutput)
+	protected.GET("/curve", handleCurve)
+	protected.GET("/solve", handleSolve)
+	protected.POST("/alerts", handleCreateAlert)
+	protected.GET("/alerts", handleListAlerts)
+	protected.DELETE("/alerts/:id", handleDeleteAlert)
+	router.GET("/pairs/freshness", handlePairFreshness)
+	router.GET("/cache/stats", handleCacheStats)
+	router.GET("/validate-token", handleValidateToken)
+	router.GET("/tokens", handleTokens)
+	admin := router.Group("/admin", requireAdmin)
+	admin.GET("/logs/stream", handleLogStream)
+	admin.GET("/cache/export", handleCacheExport)
+	admin.POST("/cache/import", handleCacheImport)
+	admin.POST("/maintenance", handleSetMaintenance)
+	router.DELETE("/cache", requireAdmin, handleCacheEvict)
+
+	router.GET("/onchain", handleOnchainQuote)
+	router.GET("/twap", handleTWAP)
+	router.GET("/history", handleHistory)
+	router.GET("/feed", handleFeed)
+	router.GET("/slo", handleSLO)
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	router.GET("/health", handleHealth)
+	router.GET("/version", handleVersion)
+	// liveness only, never touches the browser pool or the cache
+	router.GET("/ping", func(c *gin.Context) {
+		c.String(http.StatusOK, "pong")
 	})
 	return router
 }
 
 func main() {
-	router := setupRouter()
-	err := router.Run(":3000")
+	setupLogging(io.MultiWriter(os.Stderr, logBuffer))
+
+	if err := loadConfig(); err != nil {
+		log.Fatalf("[CONFIG] %v", err)
+	}
+	addresses, err := checksumTokenAddresses(tokenAddresses)
 	if err != nil {
+		log.Fatalf("[CONFIG] Invalid token list: %v", err)
+	}
+	tokenAddresses = addresses
+	for address, symbols := range sharedAddresses(tokenAddresses) {
+		log.Printf("[CONFIG] Tokens %s share address %s", strings.Join(symbols, ", "), address)
+	}
+
+	priceSource = KuruSource{}
+	if redisURL != "" {
+		redisCache, err := newRedisCache(redisURL)
+		if err != nil {
+			log.Fatalf("[CONFIG] Invalid REDIS_URL: %v", err)
+		}
+		cache.remote = redisCache
+		log.Printf("[CACHE] Sharing quotes through Redis at %s", redisCache.client.Options().Addr)
+	}
+
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	go runCacheSweeper(backgroundCtx)
+	go runHitRateWatchdog(backgroundCtx)
+	go browserPool.Autoscale(backgroundCtx)
+	go runAlertPoller(backgroundCtx)
+	go runKeepalive(backgroundCtx)
+	go runCacheStatsLogger(backgroundCtx)
+
+	if _, err := startBrowser(); err != nil {
+		// scrapes retry the launch, cached and rpc routes keep working
+		log.Printf("[BROWSER] %v", err)
+	}
+	go warmCache(backgroundCtx)
+
+	log.Printf("[CONFIG] Listening on :%s, cache TTL %v, fetch timeout %v", listenPort, cacheTTL, fetchTimeout)
+
+	router := setupRouter()
+	server := newServer(":"+listenPort, router)
+
+	signalCtx, stopSignals := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stopSignals()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- serve(server)
+	}()
+
+	select {
+	case err := <-serveErr:
+		stopBackground()
+		stopBrowser()
 		log.Fatal("Failed to start server: ", err)
+	case <-signalCtx.Done():
 	}
+
+	log.Printf("[SERVER] Shutting down, draining requests for up to %v", shutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("[SERVER] Shutdown did not finish cleanly: %v", err)
+	}
+
+	stopBackground()
+	stopBrowser()
+	closePublisher()
+	log.Printf("[SERVER] Stopped")
 }
@@ -0,0 +1,782 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestMain loads the configuration from the test environment, the way main
+// does before serving.
+func TestMain(m *testing.M) {
+	if err := loadConfig(); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// fakeSource answers every fetch with result or err and counts the calls.
+// With hang set it instead blocks until the fetch is cancelled.
+type fakeSource struct {
+	mutex  sync.Mutex
+	result Result
+	err    error
+	hang   bool
+	calls  int
+	side   string
+}
+
+func (f *fakeSource) Fetch(ctx context.Context, inputToken, outputToken, amount string) (Result, error) {
+	f.mutex.Lock()
+	f.calls++
+	f.side = sideFromContext(ctx)
+	result, err, hang := f.result, f.err, f.hang
+	f.mutex.Unlock()
+
+	if hang {
+		<-ctx.Done()
+		return Result{}, ctx.Err()
+	}
+	return result, err
+}
+
+func (f *fakeSource) Calls() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.calls
+}
+
+// newTestServer serves setupRouter on top of source, with empty caches so
+// tests don't see each other's quotes.
+func newTestServer(t *testing.T, source PriceSource) *httptest.Server {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	previousSource, previousCache, previousRates := priceSource, cache, rateCache
+	priceSource, cache, rateCache = source, NewTokenPairCache(), NewRateCache()
+	throttle, negativeCache = NewScrapeThrottle(), NewNegativeCache()
+	rateLimiter = NewRateLimiter(rateLimitPerMinute, rateLimitBurst)
+
+	server := httptest.NewServer(setupRouter())
+	t.Cleanup(func() {
+		server.Close()
+		priceSource, cache, rateCache = previousSource, previousCache, previousRates
+	})
+	return server
+}
+
+func liveResult(inputToken, outputToken string, inputAmount, outputAmount float64) Result {
+	return buildResult(inputToken, outputToken, inputAmount, outputAmount, scrapedQuote{})
+}
+
+func getJSON(t *testing.T, url string) (int, map[string]interface{}) {
+	t.Helper()
+
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+
+	var body map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("decoding response of %s: %v", url, err)
+	}
+	return resp.StatusCode, body
+}
+
+func TestHandleTokenPrice(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		result     Result
+		err        error
+		wantStatus int
+		wantError  bool
+		wantCode   ErrorCode
+		wantCalls  int
+	}{
+		{
+			name:       "missing input",
+			query:      "?amount=1",
+			wantStatus: http.StatusBadRequest,
+			wantError:  true,
+			wantCode:   CODE_INVALID_PARAMETER,
+		},
+		{
+			name:       "same token",
+			query:      "?input=usdc&output=USDC&amount=1",
+			wantStatus: http.StatusBadRequest,
+			wantError:  true,
+			wantCode:   CODE_INVALID_PARAMETER,
+		},
+		{
+			name:       "alias of the input",
+			query:      "?input=mon&output=wmon&amount=1",
+			wantStatus: http.StatusBadRequest,
+			wantError:  true,
+			wantCode:   CODE_INVALID_PARAMETER,
+		},
+		{
+			name:       "missing amount",
+			query:      "?input=mon&output=usdc",
+			wantStatus: http.StatusBadRequest,
+			wantError:  true,
+			wantCode:   CODE_INVALID_PARAMETER,
+		},
+		{
+			name:       "unsupported input token",
+			query:      "?input=doge&output=usdc&amount=1",
+			wantStatus: http.StatusBadRequest,
+			wantError:  true,
+			wantCode:   CODE_UNSUPPORTED_TOKEN,
+		},
+		{
+			name:       "unsupported output token",
+			query:      "?input=mon&output=doge&amount=1",
+			wantStatus: http.StatusBadRequest,
+			wantError:  true,
+			wantCode:   CODE_UNSUPPORTED_TOKEN,
+		},
+		{
+			name:       "invalid amount",
+			query:      "?input=mon&output=usdc&amount=-1",
+			wantStatus: http.StatusBadRequest,
+			wantError:  true,
+			wantCode:   CODE_INVALID_AMOUNT,
+		},
+		{
+			name:       "live quote",
+			query:      "?input=mon&output=usdc&amount=2",
+			result:     liveResult("mon", "usdc", 2, 7),
+			wantStatus: http.StatusOK,
+			wantCalls:  1,
+		},
+		{
+			name:       "source error",
+			query:      "?input=mon&output=usdc&amount=1",
+			err:        errors.New("page never loaded"),
+			wantStatus: http.StatusInternalServerError,
+			wantError:  true,
+			wantCode:   CODE_SCRAPE_FAILED,
+			wantCalls:  1,
+		},
+		{
+			name:       "no route",
+			query:      "?input=mon&output=dak&amount=1",
+			err:        errNoRoute,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantError:  true,
+			wantCode:   CODE_NO_ROUTE,
+			wantCalls:  1,
+		},
+		{
+			name:       "pair shorthand",
+			query:      "?pair=MON/USDC&amount=2",
+			result:     liveResult("mon", "usdc", 2, 7),
+			wantStatus: http.StatusOK,
+			wantCalls:  1,
+		},
+		{
+			name:       "pair with a dash takes precedence",
+			query:      "?pair=mon-usdc&input=doge&amount=2",
+			result:     liveResult("mon", "usdc", 2, 7),
+			wantStatus: http.StatusOK,
+			wantCalls:  1,
+		},
+		{
+			name:       "malformed pair",
+			query:      "?pair=mon&amount=2",
+			wantStatus: http.StatusBadRequest,
+			wantError:  true,
+			wantCode:   CODE_INVALID_PARAMETER,
+		},
+		{
+			name:       "pair with an unsupported token",
+			query:      "?pair=mon/doge&amount=2",
+			wantStatus: http.StatusBadRequest,
+			wantError:  true,
+			wantCode:   CODE_UNSUPPORTED_TOKEN,
+		},
+		{
+			name:       "upstream timeout",
+			query:      "?input=mon&output=usdc&amount=1",
+			err:        context.DeadlineExceeded,
+			wantStatus: http.StatusGatewayTimeout,
+			wantError:  true,
+			wantCode:   CODE_UPSTREAM_TIMEOUT,
+			wantCalls:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := &fakeSource{result: tt.result, err: tt.err}
+			server := newTestServer(t, source)
+
+			status, body := getJSON(t, server.URL+"/"+tt.query)
+			if status != tt.wantStatus {
+				t.Errorf("status = %d, want %d (body %v)", status, tt.wantStatus, body)
+			}
+			if _, hasError := body["error"]; hasError != tt.wantError {
+				t.Errorf("error in body = %v, want %v (body %v)", hasError, tt.wantError, body)
+			}
+			if code, _ := body["code"].(string); code != string(tt.wantCode) {
+				t.Errorf("code = %q, want %q", code, tt.wantCode)
+			}
+			if source.Calls() != tt.wantCalls {
+				t.Errorf("source called %d times, want %d", source.Calls(), tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestHandleTokenPriceLiveQuote(t *testing.T) {
+	source := &fakeSource{result: liveResult("mon", "usdc", 2, 7)}
+	server := newTestServer(t, source)
+
+	status, body := getJSON(t, server.URL+"/?input=mon&output=usdc&amount=2")
+	if status != http.StatusOK {
+		t.Fatalf("status = %d, body %v", status, body)
+	}
+	if body["exchange_rate"] != 3.5 {
+		t.Errorf("exchange_rate = %v, want 3.5", body["exchange_rate"])
+	}
+	if body["source"] != "live" {
+		t.Errorf("source = %v, want live", body["source"])
+	}
+}
+
+func TestHandleTokenPriceCacheHit(t *testing.T) {
+	source := &fakeSource{err: errors.New("must not be called")}
+	server := newTestServer(t, source)
+	cache.Set("mon", "usdc", "5", liveResult("mon", "usdc", 5, 16))
+
+	status, body := getJSON(t, server.URL+"/?input=mon&output=usdc&amount=5")
+	if status != http.StatusOK {
+		t.Fatalf("status = %d, body %v", status, body)
+	}
+	if body["source"] != "cache" {
+		t.Errorf("source = %v, want cache", body["source"])
+	}
+	if source.Calls() != 0 {
+		t.Errorf("source called %d times on a cache hit", source.Calls())
+	}
+}
+
+func TestHandleTokenPriceCachesLiveQuote(t *testing.T) {
+	source := &fakeSource{result: liveResult("mon", "usdc", 3, 9)}
+	server := newTestServer(t, source)
+
+	for i := 0; i < 3; i++ {
+		if status, body := getJSON(t, server.URL+"/?input=mon&output=usdc&amount=3"); status != http.StatusOK {
+			t.Fatalf("request %d: status = %d, body %v", i, status, body)
+		}
+	}
+	if source.Calls() != 1 {
+		t.Errorf("source called %d times, want 1", source.Calls())
+	}
+}
+
+func TestPathRouteMatchesQueryRoute(t *testing.T) {
+	source := &fakeSource{result: liveResult("mon", "usdc", 4, 12)}
+	server := newTestServer(t, source)
+
+	_, byQuery := getJSON(t, server.URL+"/?input=mon&output=usdc&amount=4")
+	_, byPath := getJSON(t, server.URL+"/price/mon/usdc/4")
+	if byQuery["exchange_rate"] != byPath["exchange_rate"] {
+		t.Errorf("exchange_rate by query %v, by path %v", byQuery["exchange_rate"], byPath["exchange_rate"])
+	}
+	if source.Calls() != 1 {
+		t.Errorf("source called %d times, want 1", source.Calls())
+	}
+}
+
+func TestHandleTokenPriceFresh(t *testing.T) {
+	cached := liveResult("mon", "usdc", 1, 2)
+	source := &fakeSource{result: liveResult("mon", "usdc", 1, 3)}
+	server := newTestServer(t, source)
+	cache.Set("mon", "usdc", "1", cached)
+
+	status, body := getJSON(t, server.URL+"/?input=mon&output=usdc&amount=1&fresh=true")
+	if status != http.StatusOK {
+		t.Fatalf("status = %d, body %v", status, body)
+	}
+	if body["exchange_rate"] != 3.0 || source.Calls() != 1 {
+		t.Errorf("exchange_rate = %v after %d fetches, want a live 3", body["exchange_rate"], source.Calls())
+	}
+	if cached, _ := cache.Get("mon", "usdc", "1"); cached.ExchangeRate != 3 {
+		t.Errorf("cache holds rate %v, want the fresh 3", cached.ExchangeRate)
+	}
+}
+
+func TestRequireAPIKey(t *testing.T) {
+	server := newTestServer(t, &fakeSource{})
+	previous := apiKeys
+	apiKeys = parseAPIKeys("first, second")
+	t.Cleanup(func() { apiKeys = previous })
+
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		want   int
+	}{
+		{"no key", "", "", http.StatusUnauthorized},
+		{"wrong key", "X-API-Key", "third", http.StatusUnauthorized},
+		{"api key header", "X-API-Key", "second", http.StatusOK},
+		{"bearer token", "Authorization", "Bearer first", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, server.URL+"/alerts", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+
+	if status, _ := getJSON(t, server.URL+"/health"); status == http.StatusUnauthorized {
+		t.Errorf("/health requires a key")
+	}
+}
+
+func TestHandleTokenPriceOutputUSD(t *testing.T) {
+	source := &fakeSource{result: liveResult("usdc", "mon", 1, 4)}
+	server := newTestServer(t, source)
+	cache.Set("mon", "usdc", UNIT_AMOUNT, liveResult("mon", "usdc", 1, 0.5))
+
+	status, body := getJSON(t, server.URL+"/?input=usdc&output=mon&amount=1&usd=true")
+	if status != http.StatusOK {
+		t.Fatalf("status = %d, body %v", status, body)
+	}
+	if body["output_usd"] != 2.0 {
+		t.Errorf("output_usd = %v, want 4 mon at 0.5", body["output_usd"])
+	}
+	if source.Calls() != 1 {
+		t.Errorf("%d fetches, want the usd leg served from the cache", source.Calls())
+	}
+}
+
+func TestHandleTokenPriceSpotMode(t *testing.T) {
+	server := newTestServer(t, &fakeSource{result: liveResult("mon", "usdc", 0.01, 0.0354)})
+
+	status, body := getJSON(t, server.URL+"/?input=mon&output=usdc&mode=spot")
+	if status != http.StatusOK {
+		t.Fatalf("status = %d, body %v", status, body)
+	}
+	if body["mode"] != "spot" || body["spot_price"] != 3.54 {
+		t.Errorf("mode = %v, spot_price = %v, want a spot price of 3.54", body["mode"], body["spot_price"])
+	}
+	if got := spotAmount("mon"); got != "0.01" {
+		t.Errorf("spotAmount(mon) = %q, want 0.01", got)
+	}
+}
+
+func TestHandleTokenPriceOutputSide(t *testing.T) {
+	source := &fakeSource{result: liveResult("mon", "usdc", 28.57, 100)}
+	server := newTestServer(t, source)
+
+	status, body := getJSON(t, server.URL+"/?input=mon&output=usdc&amount=100&side=output")
+	if status != http.StatusOK {
+		t.Fatalf("status = %d, body %v", status, body)
+	}
+	if source.side != SIDE_OUTPUT || body["side"] != SIDE_OUTPUT {
+		t.Errorf("fetched for side %q, labeled %v, want output", source.side, body["side"])
+	}
+	if input := body["input"].(map[string]interface{}); input["amount"] != 28.57 {
+		t.Errorf("input amount = %v, want the 28.57 kuru asks for", input["amount"])
+	}
+	if cache.Len() != 0 {
+		t.Errorf("cache holds %d entries, want exact-output quotes kept out of it", cache.Len())
+	}
+
+	for _, query := range []string{"side=both", "side=output&mode=spot"} {
+		if status, _ := getJSON(t, server.URL+"/?input=mon&output=usdc&amount=100&"+query); status != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", query, status)
+		}
+	}
+}
+
+func TestHandleTokenPriceConditional(t *testing.T) {
+	source := &fakeSource{result: liveResult("mon", "usdc", 1, 3.5)}
+	server := newTestServer(t, source)
+	url := server.URL + "/?input=mon&output=usdc&amount=1"
+
+	first, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.Body.Close()
+	etag := first.Header.Get("ETag")
+	if etag == "" || first.Header.Get("Last-Modified") == "" {
+		t.Fatalf("ETag %q, Last-Modified %q, want both set", etag, first.Header.Get("Last-Modified"))
+	}
+
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		want   int
+	}{
+		{"matching etag", "If-None-Match", etag, http.StatusNotModified},
+		{"other etag", "If-None-Match", `W/"1-000000000000"`, http.StatusOK},
+		{"not modified since", "If-Modified-Since", first.Header.Get("Last-Modified"), http.StatusNotModified},
+		{"modified since", "If-Modified-Since", time.Unix(0, 0).UTC().Format(http.TimeFormat), http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, url, nil)
+			req.Header.Set(tt.header, tt.value)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+			if resp.Header.Get("ETag") != etag {
+				t.Errorf("ETag = %q, want the cached quote's %q", resp.Header.Get("ETag"), etag)
+			}
+		})
+	}
+}
+
+func TestHandleTokenPriceRejectsSharedAddress(t *testing.T) {
+	// without the alias wmon is its own symbol, but still mon's address
+	delete(tokenAliases, "wmon")
+	t.Cleanup(func() { tokenAliases["wmon"] = "mon" })
+	source := &fakeSource{result: liveResult("mon", "wmon", 1, 1)}
+	server := newTestServer(t, source)
+
+	status, body := getJSON(t, server.URL+"/?input=mon&output=wmon&amount=1")
+	if status != http.StatusBadRequest || body["error"] != "input and output tokens must differ" {
+		t.Errorf("status = %d, body %v, want a 400 for tokens sharing an address", status, body)
+	}
+	if source.Calls() != 0 {
+		t.Errorf("%d fetches, want none", source.Calls())
+	}
+	if _, err := validateBatchPair(BatchPair{Input: "mon", Output: "wmon", Amount: "1"}); !errors.Is(err, errSameToken) {
+		t.Errorf("validateBatchPair of tokens sharing an address = %v, want errSameToken", err)
+	}
+}
+
+func TestHandleTokenPriceTimeout(t *testing.T) {
+	server := newTestServer(t, &fakeSource{hang: true})
+
+	start := time.Now()
+	status, body := getJSON(t, server.URL+"/?input=mon&output=usdc&amount=1&timeout=100ms")
+	if status != http.StatusGatewayTimeout || body["code"] != string(CODE_UPSTREAM_TIMEOUT) {
+		t.Errorf("status = %d, body %v, want a 504 UPSTREAM_TIMEOUT", status, body)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("answered after %v, want about the 100ms timeout", elapsed)
+	}
+
+	if status, _ := getJSON(t, server.URL+"/?input=mon&output=usdc&amount=1&timeout=soon"); status != http.StatusBadRequest {
+		t.Errorf("status = %d for an unparseable timeout, want 400", status)
+	}
+}
+
+func TestMaintenanceModeServesCacheOnly(t *testing.T) {
+	previousToken := adminToken
+	adminToken = "secret"
+	t.Cleanup(func() {
+		adminToken = previousToken
+		maintenanceMode.Store(false)
+	})
+	source := &fakeSource{result: liveResult("mon", "usdc", 1, 3.5)}
+	server := newTestServer(t, source)
+	cache.Set("mon", "usdc", "5", liveResult("mon", "usdc", 5, 16))
+
+	setMaintenance := func(enabled string) {
+		t.Helper()
+		request, _ := http.NewRequest(http.MethodPost, server.URL+"/admin/maintenance", strings.NewReader(`{"enabled": `+enabled+`}`))
+		request.Header.Set("X-Admin-Token", "secret")
+		resp, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("setting maintenance to %s: status %d", enabled, resp.StatusCode)
+		}
+	}
+
+	setMaintenance("true")
+	if _, body := getJSON(t, server.URL+"/health"); body["maintenance"] != true {
+		t.Errorf("health = %v, want maintenance reported", body)
+	}
+	if status, _ := getJSON(t, server.URL+"/?input=mon&output=usdc&amount=5"); status != http.StatusOK {
+		t.Errorf("cache hit status = %d in maintenance, want 200", status)
+	}
+	status, body := getJSON(t, server.URL+"/?input=mon&output=usdc&amount=1")
+	if status != http.StatusServiceUnavailable || body["code"] != string(CODE_UNAVAILABLE) {
+		t.Errorf("cache miss status = %d, body %v, want a 503 UNAVAILABLE", status, body)
+	}
+	if source.Calls() != 0 {
+		t.Errorf("%d fetches in maintenance, want none", source.Calls())
+	}
+
+	setMaintenance("false")
+	if status, _ := getJSON(t, server.URL+"/?input=mon&output=usdc&amount=1"); status != http.StatusOK || source.Calls() != 1 {
+		t.Errorf("status = %d with %d fetches after leaving maintenance, want a live quote", status, source.Calls())
+	}
+}
+
+func TestLoadConfigRejectsBadSettings(t *testing.T) {
+	for key, value := range map[string]string{
+		"TLS_CERT":       "cert.pem",
+		"DUST_PRECISION": "exend",
+	} {
+		t.Run(key, func(t *testing.T) {
+			t.Setenv(key, value)
+			if err := loadConfig(); err == nil || !strings.Contains(err.Error(), key) {
+				t.Errorf("loadConfig() = %v, want %s=%s reported", err, key, value)
+			}
+		})
+	}
+	if err := loadConfig(); err != nil {
+		t.Fatalf("reloading the test configuration: %v", err)
+	}
+}
+
+func TestGzipVariesOnAcceptEncoding(t *testing.T) {
+	server := newTestServer(t, &fakeSource{result: liveResult("mon", "usdc", 1, 3)})
+
+	// a transport left to compress would ask for gzip on its own
+	transport := &http.Transport{DisableCompression: true}
+	for _, encoding := range []string{"", "gzip"} {
+		request, _ := http.NewRequest(http.MethodGet, server.URL+"/?input=mon&output=usdc&amount=1", nil)
+		if encoding != "" {
+			request.Header.Set("Accept-Encoding", encoding)
+		}
+		resp, err := transport.RoundTrip(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if !strings.Contains(resp.Header.Get("Vary"), "Accept-Encoding") {
+			t.Errorf("Accept-Encoding %q: Vary = %q, want Accept-Encoding", encoding, resp.Header.Get("Vary"))
+		}
+	}
+}
+
+func TestLogStreamOutlivesWriteTimeout(t *testing.T) {
+	previousToken := adminToken
+	adminToken = "secret"
+	t.Cleanup(func() { adminToken = previousToken })
+
+	server := httptest.NewUnstartedServer(setupRouter())
+	server.Config.WriteTimeout = 200 * time.Millisecond
+	server.Start()
+	t.Cleanup(server.Close)
+
+	// the backlog gets the response headers out straight away
+	logBuffer.Write([]byte("before the stream\n"))
+	request, _ := http.NewRequest(http.MethodGet, server.URL+"/admin/logs/stream", nil)
+	request.Header.Set("X-Admin-Token", "secret")
+	request.Header.Set("Accept-Encoding", "gzip")
+	resp, err := (&http.Transport{DisableCompression: true}).RoundTrip(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	time.Sleep(3 * server.Config.WriteTimeout)
+	logBuffer.Write([]byte("past the write deadline\n"))
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatal("stream closed at the write deadline")
+			}
+			if strings.Contains(line, "past the write deadline") {
+				return
+			}
+		case <-timeout:
+			t.Fatal("log line not streamed")
+		}
+	}
+}
+
+func TestHandleBasketValidatesItems(t *testing.T) {
+	server := newTestServer(t, &fakeSource{result: liveResult("mon", "usdc", 2, 7)})
+
+	resp, err := http.Post(server.URL+"/basket", "application/json", strings.NewReader(
+		`[{"token": "MON", "amount": 2}, {"token": "mon", "amount": -1}, {"token": "usdc", "amount": 5}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var basket BasketResponse
+	if err := json.NewDecoder(resp.Body).Decode(&basket); err != nil {
+		t.Fatal(err)
+	}
+
+	if item := basket.Items[0]; item.Error != "" || item.Token != "mon" || item.Value != 7 {
+		t.Errorf("MON item = %+v, want 7 usdc for the normalized token", item)
+	}
+	if item := basket.Items[1]; item.Error == "" {
+		t.Errorf("negative amount accepted: %+v", item)
+	}
+	if item := basket.Items[2]; item.Error != "" || item.Value != 5 {
+		t.Errorf("usdc item = %+v, want its own amount", item)
+	}
+}
+
+func TestHandleMultiOutputGoesThroughPriceSource(t *testing.T) {
+	source := &fakeSource{result: liveResult("mon", "usdc", 2, 7)}
+	server := newTestServer(t, source)
+	cache.Set("mon", "dak", "2", liveResult("mon", "dak", 2, 40))
+
+	resp, err := http.Get(server.URL + "/multi?input=MON&outputs=usdc,dak&amount=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var results []map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 2 || results[0]["error"] != nil || results[1]["error"] != nil {
+		t.Fatalf("results = %v, want a quote per output", results)
+	}
+	if source.Calls() != 1 {
+		t.Errorf("source called %d times, want once for the uncached output", source.Calls())
+	}
+}
+
+func TestHandleTokenPriceRejectsBadOptionsBeforeScraping(t *testing.T) {
+	source := &fakeSource{result: liveResult("mon", "usdc", 1, 3)}
+	server := newTestServer(t, source)
+
+	for _, query := range []string{"decimals=abc", "sig_figs=0", "rounding=up", "callback=1x"} {
+		status, body := getJSON(t, server.URL+"/?input=mon&output=usdc&amount=1&"+query)
+		if status != http.StatusBadRequest || body["code"] != string(CODE_INVALID_PARAMETER) {
+			t.Errorf("%s: status = %d, body %v, want 400 with code %s", query, status, body, CODE_INVALID_PARAMETER)
+		}
+	}
+	if source.Calls() != 0 {
+		t.Errorf("source called %d times for requests that were rejected", source.Calls())
+	}
+}
+
+func TestHandleOnchainQuoteRejectsBadAmounts(t *testing.T) {
+	server := newTestServer(t, &fakeSource{})
+
+	for _, amount := range []string{"-1", "abc", "0", "1.0000000000000000001"} {
+		status, body := getJSON(t, server.URL+"/onchain?input=mon&output=usdc&amount="+amount)
+		if status != http.StatusBadRequest || body["code"] != string(CODE_INVALID_AMOUNT) {
+			t.Errorf("amount %s: status = %d, body %v, want 400 with code %s", amount, status, body, CODE_INVALID_AMOUNT)
+		}
+	}
+}
+
+func TestCORSPreflightAllowsAPIKey(t *testing.T) {
+	server := newTestServer(t, &fakeSource{})
+
+	req, err := http.NewRequest(http.MethodOptions, server.URL+"/batch", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Origin", "https://app.example")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	req.Header.Set("Access-Control-Request-Headers", "x-api-key, if-none-match")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusNoContent)
+	}
+	allowed := strings.ToLower(resp.Header.Get("Access-Control-Allow-Headers"))
+	for _, header := range []string{"x-api-key", "if-none-match"} {
+		if !strings.Contains(allowed, header) {
+			t.Errorf("Access-Control-Allow-Headers = %q, missing %s", allowed, header)
+		}
+	}
+	if exposed := resp.Header.Get("Access-Control-Expose-Headers"); !strings.Contains(exposed, "ETag") {
+		t.Errorf("Access-Control-Expose-Headers = %q, want ETag exposed", exposed)
+	}
+}
+
+func TestSolveInputStopsWhenTheRequestIsCancelled(t *testing.T) {
+	newTestServer(t, &fakeSource{hang: true})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, _, _, _, err := solveInput(ctx, "mon", "usdc", 10, SOLVE_DEFAULT_TOLERANCE_BPS)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("err = %v, want the request's deadline", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("solveInput kept probing after the request was cancelled")
+	}
+}
+
+func TestHandleSolveRejectsProbesOutsideTheAmountLimits(t *testing.T) {
+	source := &fakeSource{result: liveResult("mon", "usdc", 1, 1e-12)}
+	server := newTestServer(t, source)
+
+	status, body := getJSON(t, server.URL+"/solve?input=mon&output=usdc&target_output=1000000")
+	if status != http.StatusBadRequest || body["code"] != string(CODE_INVALID_AMOUNT) {
+		t.Errorf("status = %d, body %v, want 400 with code %s", status, body, CODE_INVALID_AMOUNT)
+	}
+	if source.Calls() != 1 {
+		t.Errorf("source called %d times, want only the unit quote", source.Calls())
+	}
+}
+
+func TestManualOverrideQuotesTheRequestedAmount(t *testing.T) {
+	previousChain, previousPrices, previousDecimals := fallbackChain, manualPrices, cacheKeyDecimals
+	t.Cleanup(func() { fallbackChain, manualPrices, cacheKeyDecimals = previousChain, previousPrices, previousDecimals })
+	fallbackChain, manualPrices, cacheKeyDecimals = []string{"manual_override"}, map[string]float64{"mon/usdc": 2}, 0
+
+	result, err := applyFallbacks("mon", "usdc", "1.5", errNoRoute, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Input.Amount != 1.5 || result.Output.Amount != 3 {
+		t.Errorf("quoted %v for %v, want 3 for the requested 1.5 rather than its cache bucket", result.Output.Amount, result.Input.Amount)
+	}
+}
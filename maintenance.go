@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errMaintenance = errors.New("in maintenance, only cached quotes are served")
+
+// maintenanceMode stops new scrapes while cached quotes keep being served,
+// to spare kuru and the host during an incident or a deploy. It starts from
+// MAINTENANCE_MODE and is flipped at runtime through POST /admin/maintenance.
+var maintenanceMode = newMaintenanceFlag(envBool("MAINTENANCE_MODE", false))
+
+func newMaintenanceFlag(enabled bool) *atomic.Bool {
+	var flag atomic.Bool
+	flag.Store(enabled)
+	return &flag
+}
+
+func handleSetMaintenance(c *gin.Context) {
+	var request struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil || request.Enabled == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": `body must be {"enabled": true} or {"enabled": false}`})
+		return
+	}
+
+	if maintenanceMode.Swap(*request.Enabled) != *request.Enabled {
+		if *request.Enabled {
+			log.Printf("[MAINTENANCE] Entered maintenance, serving cached quotes only")
+		} else {
+			log.Printf("[MAINTENANCE] Left maintenance, scraping again")
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"maintenance": *request.Enabled})
+}
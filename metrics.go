@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chromedp/chromedp"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// scrapePhaseDuration breaks a scrape down into navigate, wait_visible,
+// settle (typing the amount and waiting for the quote) and extract (reading
+// the values back), so a slow upstream can be told apart from our own delays.
+var scrapePhaseDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "kuru_scrape_phase_duration_seconds",
+	Help:    "Duration of each phase of a kuru swap page scrape.",
+	Buckets: []float64{0.1, 0.25, 0.5, 1, 2, 3, 5, 7.5, 10, 15, 20, 30},
+}, []string{"phase", "outcome"})
+
+func timedPhase(phase string, actions ...chromedp.Action) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		start := time.Now()
+		err := chromedp.Tasks(actions).Do(ctx)
+
+		outcome := "success"
+		if err != nil {
+			outcome = "error"
+		}
+		scrapePhaseDuration.WithLabelValues(phase, outcome).Observe(time.Since(start).Seconds())
+		return err
+	})
+}
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kuru_http_requests_total",
+		Help: "HTTP requests served, by route and status code.",
+	}, []string{"route", "status"})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "kuru_http_request_duration_seconds",
+		Help:    "Time taken to answer HTTP requests, by route.",
+		Buckets: []float64{0.005, 0.01, 0.05, 0.1, 0.5, 1, 2.5, 5, 10, 20, 30, 60},
+	}, []string{"route"})
+
+	fetchDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "kuru_fetch_duration_seconds",
+		Help:    "Duration of a live fetch including retries.",
+		Buckets: []float64{1, 2, 3, 5, 7.5, 10, 15, 20, 30, 45, 60, 90},
+	}, []string{"outcome"})
+
+	scrapeErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kuru_scrape_errors_total",
+		Help: "Failed scrape attempts, by error type.",
+	}, []string{"type"})
+
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "kuru_circuit_state",
+		Help: "State of the kuru circuit breaker: 0 closed, 1 half open, 2 open.",
+	}, func() float64 {
+		return float64(kuruBreaker.State())
+	})
+
+	_ = promauto.NewCounterFunc(prometheus.CounterOpts{
+		Name: "kuru_cache_hits_total",
+		Help: "Quote cache lookups served from the cache.",
+	}, func() float64 {
+		hits, _ := cache.Counters()
+		return float64(hits)
+	})
+
+	_ = promauto.NewCounterFunc(prometheus.CounterOpts{
+		Name: "kuru_cache_misses_total",
+		Help: "Quote cache lookups that found no valid entry.",
+	}, func() float64 {
+		_, misses := cache.Counters()
+		return float64(misses)
+	})
+
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "kuru_cache_entries",
+		Help: "Entries currently held in the quote cache, expired ones included.",
+	}, func() float64 {
+		return float64(cache.Len())
+	})
+
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "kuru_browsers_in_use",
+		Help: "Browser pool slots currently scraping.",
+	}, func() float64 {
+		return float64(browserPool.InUse())
+	})
+
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "kuru_browser_queue_depth",
+		Help: "Scrapes queued for a browser pool slot.",
+	}, func() float64 {
+		return float64(browserPool.QueueDepth())
+	})
+)
+
+// scrapeErrorType buckets a scrape error for kuru_scrape_errors_total.
+func scrapeErrorType(err error) string {
+	switch {
+	case errors.Is(err, errSelectorNotFound):
+		return "selector_not_found"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, errInvalidResult):
+		return "invalid_result"
+	case errors.Is(err, errNoRoute), errors.Is(err, errEmptyOutput):
+		return "no_route"
+	case errors.Is(err, strconv.ErrSyntax), errors.Is(err, strconv.ErrRange), errors.Is(err, errZeroInput):
+		return "parse"
+	case strings.Contains(err.Error(), "browser"), strings.Contains(err.Error(), "tab"):
+		return "browser"
+	}
+	return "other"
+}
+
+func metricsMiddleware(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+
+	route := c.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+	httpRequests.WithLabelValues(route, strconv.Itoa(c.Writer.Status())).Inc()
+	httpRequestDuration.WithLabelValues(route).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/chromedp/chromedp"
+	"github.com/gin-gonic/gin"
+)
+
+const MULTI_MAX_OUTPUTS = 10
+
+// SWITCH_PAIR_SCRIPT moves the open swap page to another pair through kuru's
+// client-side router, which keeps the page loaded. It returns false when the
+// page exposes no router to do that with.
+const SWITCH_PAIR_SCRIPT = `((url) => {
+	const router = window.next && window.next.router;
+	if (!router || typeof router.replace !== "function") return false;
+	router.replace(url);
+	return true;
+})(%s)`
+
+const PAIR_SHOWN_SCRIPT = `location.href.toLowerCase().includes(%s)`
+
+// multiPage is the swap page fetchMultiOutput keeps open across outputs.
+type multiPage struct {
+	tabCtx   context.Context
+	close    func()
+	mirror   string // host the page is open on, empty until it is
+	selector string // the amount input that matched on it
+}
+
+// show points the page at the pair. Once the page is open only the output
+// token is changed in place, falling back to loading the page when that
+// can't be done. The returned context bounds one quote to FETCH_TIMEOUT.
+func (p *multiPage) show(selectors Selectors, outputAddress string, targetURLs []string) (context.Context, context.CancelFunc, error) {
+	if targetURL := urlOnHost(targetURLs, p.mirror); targetURL != "" {
+		ctx, cancel := context.WithTimeout(context.WithValue(p.tabCtx, inputSelectorKey{}, p.selector), fetchTimeout)
+		switched, err := switchOutput(ctx, targetURL, outputAddress, p.selector)
+		if err == nil && switched {
+			return ctx, cancel, nil
+		}
+		cancel()
+		if err != nil {
+			log.Printf("[MULTI] Switching the output in place failed, reloading: %v", err)
+		}
+	}
+
+	ctx, cancel, mirror, err := openSwapPage(p.tabCtx, selectors, targetURLs)
+	if err != nil {
+		p.mirror = ""
+		return nil, nil, err
+	}
+	p.mirror, p.selector = mirror, inputSelector(ctx, selectors)
+	return ctx, cancel, nil
+}
+
+// urlOnHost picks the mirror URL on host, so a switch stays on the page's
+// origin.
+func urlOnHost(targetURLs []string, host string) string {
+	if host == "" {
+		return ""
+	}
+	for _, targetURL := range targetURLs {
+		if mirrorHost(targetURL) == host {
+			return targetURL
+		}
+	}
+	return ""
+}
+
+// switchOutput routes the page to targetURL and waits for the swap form to
+// come back for the new output token.
+func switchOutput(ctx context.Context, targetURL, outputAddress, selector string) (bool, error) {
+	parsed, err := url.Parse(targetURL)
+	if err != nil {
+		return false, err
+	}
+	var switched bool
+	if err := chromedp.Run(ctx, chromedp.Evaluate(fmt.Sprintf(SWITCH_PAIR_SCRIPT, jsString(parsed.RequestURI())), &switched)); err != nil || !switched {
+		return false, err
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, formReadyTimeout)
+	defer cancel()
+	script := fmt.Sprintf(PAIR_SHOWN_SCRIPT, jsString(strings.ToLower(outputAddress)))
+	for {
+		var shown bool
+		if err := chromedp.Run(waitCtx, chromedp.Evaluate(script, &shown)); err != nil {
+			return false, fmt.Errorf("waiting for the output token to change: %w", err)
+		}
+		if shown {
+			break
+		}
+		select {
+		case <-waitCtx.Done():
+			return false, fmt.Errorf("output token not changed after %v", formReadyTimeout)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	return true, chromedp.Run(ctx, waitFormReady(&selector))
+}
+
+// FetchOutputs prices one input against several outputs on a single page: it
+// is loaded for the first output, and for the others only the "to" token is
+// changed before reading the output again. One tab and one pool slot are
+// taken instead of one per output, each output still going through the
+// circuit breaker and scrape retries like Fetch. The tab is closed as soon as
+// ctx is done.
+func (KuruSource) FetchOutputs(ctx context.Context, inputToken string, outputTokens []string, amount string) ([]Result, []error) {
+	results := make([]Result, len(outputTokens))
+	errs := make([]error, len(outputTokens))
+
+	var page *multiPage
+	openPage := func() error {
+		if page != nil {
+			return nil
+		}
+		if err := acquireBrowser(ctx, priorityFromContext(ctx)); err != nil {
+			return err
+		}
+		tabCtx, cancel, err := newTab()
+		if err != nil {
+			browserPool.Release()
+			return err
+		}
+		stop := context.AfterFunc(ctx, cancel)
+		page = &multiPage{tabCtx: tabCtx, close: func() {
+			stop()
+			cancel()
+			browserPool.Release()
+		}}
+		return nil
+	}
+	defer func() {
+		if page != nil {
+			page.close()
+		}
+	}()
+
+	for i, outputToken := range outputTokens {
+		if errs[i] = kuruBreaker.Allow(); errs[i] != nil {
+			continue
+		}
+		if errs[i] = openPage(); errs[i] != nil {
+			continue
+		}
+		selectors := selectorsFor(inputToken, outputToken)
+		targetURLs := swapURLs(tokenAddresses[inputToken], tokenAddresses[outputToken])
+		results[i], errs[i] = scrapeWithRetries(ctx, inputToken, outputToken, amount, func() (Result, error) {
+			result, err := quoteMultiOutput(page, selectors, inputToken, outputToken, amount, targetURLs)
+			if err != nil {
+				// retry on a freshly loaded page
+				page.mirror = ""
+			}
+			return result, err
+		})
+		kuruBreaker.Record(errs[i])
+	}
+	return results, errs
+}
+
+func quoteMultiOutput(page *multiPage, selectors Selectors, inputToken, outputToken, amount string, targetURLs []string) (Result, error) {
+	ctx, cancel, err := page.show(selectors, tokenAddresses[outputToken], targetURLs)
+	if err != nil {
+		captureFailure(page.tabCtx, inputToken, outputToken, err)
+		return Result{}, err
+	}
+	defer cancel()
+	return quoteOpenPage(ctx, page.tabCtx, selectors, inputToken, outputToken, amount, SIDE_INPUT, page.mirror)
+}
+
+// fetchMultiOutput answers the cached outputs straight away and fetches the
+// rest from priceSource, in one go when it supports that.
+func fetchMultiOutput(ctx context.Context, inputToken string, outputTokens []string, amount string) []interface{} {
+	results := make([]interface{}, len(outputTokens))
+
+	var misses []int
+	var missTokens []string
+	for i, outputToken := range outputTokens {
+		if cachedResult, found := cache.Get(inputToken, outputToken, cacheKeyAmount(amount)); found && !isInvalidResult(cachedResult) {
+			results[i] = cachedResult
+			continue
+		}
+		if maintenanceMode.Load() {
+			results[i] = gin.H{"input": inputToken, "output": outputToken, "error": errMaintenance.Error()}
+			continue
+		}
+		misses = append(misses, i)
+		missTokens = append(missTokens, outputToken)
+	}
+	if len(misses) == 0 {
+		return results
+	}
+
+	var fetched []Result
+	var errs []error
+	if source, ok := priceSource.(MultiOutputSource); ok {
+		fetched, errs = source.FetchOutputs(ctx, inputToken, missTokens, amount)
+	} else {
+		fetched, errs = make([]Result, len(missTokens)), make([]error, len(missTokens))
+		for j, outputToken := range missTokens {
+			fetched[j], errs[j] = priceSource.Fetch(ctx, inputToken, outputToken, amount)
+		}
+	}
+
+	for j, i := range misses {
+		outputToken, err := missTokens[j], errs[j]
+		if err == nil && isInvalidResult(fetched[j]) {
+			err = errInvalidResult
+		}
+		if err != nil {
+			log.Printf("[MULTI] Failed to quote %s to %s: %v", inputToken, outputToken, err)
+			results[i] = gin.H{"input": inputToken, "output": outputToken, "error": err.Error()}
+			continue
+		}
+		storeQuote(inputToken, outputToken, cacheKeyAmount(amount), fetched[j])
+		results[i] = fetched[j]
+	}
+	return results
+}
+
+func handleMultiOutput(c *gin.Context) {
+	inputToken := c.Query("input")
+	amount := c.Query("amount")
+	outputsParam := c.Query("outputs")
+
+	if inputToken == "" || outputsParam == "" || amount == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "input, outputs, and amount parameters are required"})
+		return
+	}
+
+	var outputTokens []string
+	for _, outputToken := range strings.Split(outputsParam, ",") {
+		if strings.TrimSpace(outputToken) == "" {
+			continue
+		}
+		pair, err := validateBatchPair(BatchPair{Input: inputToken, Output: outputToken, Amount: amount})
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		inputToken, amount = pair.Input, pair.Amount
+		outputTokens = append(outputTokens, pair.Output)
+	}
+
+	if len(outputTokens) == 0 || len(outputTokens) > MULTI_MAX_OUTPUTS {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("outputs must list between 1 and %d tokens", MULTI_MAX_OUTPUTS)})
+		return
+	}
+
+	results := fetchMultiOutput(c.Request.Context(), inputToken, outputTokens, amount)
+	auditQuotes(c, results)
+	c.JSON(http.StatusOK, results)
+}
@@ -0,0 +1,143 @@
+package main
+
+import "testing"
+
+func TestNormalizeToken(t *testing.T) {
+	tests := map[string]string{
+		"mon":    "mon",
+		"MON":    "mon",
+		" Usdc ": "usdc",
+		"wmon":   "mon",
+		"USDT":   "usdt",
+		"doge":   "doge",
+	}
+	for input, want := range tests {
+		if got := normalizeToken(input); got != want {
+			t.Errorf("normalizeToken(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestCanonicalAmount(t *testing.T) {
+	tests := map[string]string{
+		"1":       "1",
+		"1.0":     "1",
+		"01.50":   "1.5",
+		".5":      "0.5",
+		"0.000":   "0",
+		"100":     "100",
+		"1e5":     "1e5",
+		"garbage": "garbage",
+	}
+	for input, want := range tests {
+		if got := canonicalAmount(input); got != want {
+			t.Errorf("canonicalAmount(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+// Amounts that mean the same number must share a cache entry.
+func TestEquivalentAmountsShareCacheKey(t *testing.T) {
+	groups := [][]string{
+		{"1", "1.0", "1.000", "01"},
+		{"0.5", ".5", "0.50"},
+		{"2.123456789", "2.12345678"},
+	}
+	for _, group := range groups {
+		want := cacheKey("mon", "usdc", group[0])
+		for _, amount := range group[1:] {
+			if got := cacheKey("mon", "usdc", amount); got != want {
+				t.Errorf("cacheKey for %q = %q, want %q like %q", amount, got, want, group[0])
+			}
+		}
+	}
+	if cacheKey("mon", "usdc", "1") == cacheKey("mon", "usdc", "10") {
+		t.Error("1 and 10 share a cache key")
+	}
+}
+
+func TestValidateAmount(t *testing.T) {
+	valid := []string{"1", "0.5", "1000"}
+	invalid := []string{"", "0", "-1", "NaN", "Inf", "1e5", "abc", "1e400", "0.00001"}
+	for _, amount := range valid {
+		if err := validateAmount("mon", amount); err != nil {
+			t.Errorf("validateAmount(%q) = %v, want nil", amount, err)
+		}
+	}
+	for _, amount := range invalid {
+		if err := validateAmount("mon", amount); err == nil {
+			t.Errorf("validateAmount(%q) accepted an invalid amount", amount)
+		}
+	}
+}
+
+func TestTokenAddressesAreChecksummed(t *testing.T) {
+	checksummed, err := checksumTokenAddresses(tokenAddresses)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for symbol, address := range tokenAddresses {
+		if checksummed[symbol] != address {
+			t.Errorf("%s address %s, want EIP-55 casing %s", symbol, address, checksummed[symbol])
+		}
+	}
+
+	for address, symbols := range sharedAddresses(tokenAddresses) {
+		if address != MON_ADDRESS {
+			t.Errorf("%v share address %s, only the native token and its wrapper may", symbols, address)
+		}
+	}
+
+	for _, address := range []string{
+		"0xf817257fed379853cde0fa4f97ab987181b1e5ea",
+		"0xF817257FED379853CDE0FA4F97AB987181B1E5EA",
+	} {
+		if got, err := checksumAddress(address); err != nil || got != USDC_ADDRESS {
+			t.Errorf("checksumAddress(%s) = %s, %v, want %s", address, got, err, USDC_ADDRESS)
+		}
+	}
+	for _, address := range []string{
+		"f817257fed379853cDe0fa4F97AB987181B1E5Ea",
+		"0xf817257fed379853cDe0fa4F97AB987181B1E5",
+		"0xg817257fed379853cDe0fa4F97AB987181B1E5Ea",
+		"0xF817257fed379853cDe0fa4F97AB987181B1E5Ea",
+	} {
+		if _, err := checksumAddress(address); err == nil {
+			t.Errorf("checksumAddress(%s) accepted a malformed address", address)
+		}
+	}
+}
+
+func TestParseTokenList(t *testing.T) {
+	tokens, err := parseTokenList([]byte(`[{"symbol": " WMON ", "address": "0x760afe86e5de5fa0ee542fc7b7b713e1c5425701", "decimals": 4, "chain_decimals": 18, "min_amount": 0.01}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	addresses := tokens.addresses(map[string]string{"mon": MON_ADDRESS})
+	if addresses["wmon"] != "0x760AfE86e5de5fa0Ee542fc7B7B713e1c5425701" || addresses["mon"] != MON_ADDRESS {
+		t.Errorf("addresses = %v, want wmon added in EIP-55 casing next to mon", addresses)
+	}
+	if decimals := tokens.chainDecimals(map[string]int{}); decimals["wmon"] != 18 {
+		t.Errorf("chain decimals = %v, want 18 for wmon", decimals)
+	}
+	if _, err := parseTokenList([]byte(`[{"symbol": "usdc", "address": "0xf817257fed379853cDe0fa4F97AB987181B1E5Ea", "decimals": 2}]`)); err != nil {
+		t.Errorf("built-in token without chain_decimals: %v", err)
+	}
+	if limits := tokens.amountLimits(map[string]AmountLimit{}); limits["wmon"] != (AmountLimit{Min: 0.01}) {
+		t.Errorf("limits = %v, want a 0.01 minimum for wmon", limits)
+	}
+
+	for name, data := range map[string]string{
+		"no symbol":         `[{"address": "0x760afe86e5de5fa0ee542fc7b7b713e1c5425701", "decimals": 4}]`,
+		"bad address":       `[{"symbol": "wmon", "address": "0x760afe", "decimals": 4}]`,
+		"no decimals":       `[{"symbol": "wmon", "address": "0x760afe86e5de5fa0ee542fc7b7b713e1c5425701"}]`,
+		"no chain decimals": `[{"symbol": "newt", "address": "0x760afe86e5de5fa0ee542fc7b7b713e1c5425701", "decimals": 4}]`,
+		"duplicate symbol":  `[{"symbol": "wmon", "address": "0x760afe86e5de5fa0ee542fc7b7b713e1c5425701", "decimals": 4}, {"symbol": "WMON", "address": "0x760afe86e5de5fa0ee542fc7b7b713e1c5425701", "decimals": 4}]`,
+		"min above max":     `[{"symbol": "wmon", "address": "0x760afe86e5de5fa0ee542fc7b7b713e1c5425701", "decimals": 4, "min_amount": 10, "max_amount": 1}]`,
+		"not a list":        `{"wmon": "0x760afe86e5de5fa0ee542fc7b7b713e1c5425701"}`,
+	} {
+		if _, err := parseTokenList([]byte(data)); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
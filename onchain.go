@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gin-gonic/gin"
+)
+
+const UNISWAP_V2_PAIR_ABI = `[
+	{"name":"token0","type":"function","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"address"}]},
+	{"name":"token1","type":"function","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"address"}]},
+	{"name":"getReserves","type":"function","stateMutability":"view","inputs":[],"outputs":[
+		{"name":"reserve0","type":"uint112"},
+		{"name":"reserve1","type":"uint112"},
+		{"name":"blockTimestampLast","type":"uint32"}
+	]}
+]`
+
+// onchainPools maps "input/output" pairs to constant-product (UniswapV2-style)
+// pool addresses, read from ONCHAIN_POOLS as a JSON object. A pool configured
+// for one direction also serves the reverse.
+var (
+	onchainPools  map[string]common.Address
+	onchainFeeBps = envInt("ONCHAIN_FEE_BPS", 30)
+	pairABI       = mustParseABI(UNISWAP_V2_PAIR_ABI)
+)
+
+var errNoPool = errors.New("no on-chain pool configured for this pair")
+
+func parseOnchainPools(value string) (map[string]common.Address, error) {
+	pools := make(map[string]common.Address)
+	if value == "" {
+		return pools, nil
+	}
+
+	var configured map[string]string
+	if err := json.Unmarshal([]byte(value), &configured); err != nil {
+		return nil, fmt.Errorf("invalid ONCHAIN_POOLS: %w", err)
+	}
+	for pair, address := range configured {
+		if !common.IsHexAddress(address) {
+			return nil, fmt.Errorf("ONCHAIN_POOLS has an invalid address for %s: %s", pair, address)
+		}
+		inputToken, outputToken, ok := strings.Cut(strings.ToLower(pair), "/")
+		if !ok {
+			return nil, fmt.Errorf("ONCHAIN_POOLS keys must look like input/output, got %s", pair)
+		}
+		pools[pairKey(inputToken, outputToken)] = common.HexToAddress(address)
+		pools[pairKey(outputToken, inputToken)] = common.HexToAddress(address)
+	}
+	return pools, nil
+}
+
+// constantProductOut is the UniswapV2 getAmountOut formula with the pool fee
+// taken from the input.
+func constantProductOut(amountIn, reserveIn, reserveOut *big.Int, feeBps int) *big.Int {
+	amountInWithFee := new(big.Int).Mul(amountIn, big.NewInt(int64(10000-feeBps)))
+	numerator := new(big.Int).Mul(amountInWithFee, reserveOut)
+	denominator := new(big.Int).Add(new(big.Int).Mul(reserveIn, big.NewInt(10000)), amountInWithFee)
+	return numerator.Div(numerator, denominator)
+}
+
+// fetchOnchainQuote prices amount through the QUOTER_ADDRESS contract when
+// one is configured, otherwise (or if the quoter fails and a pool is set up)
+// from the pool reserves.
+func fetchOnchainQuote(ctx context.Context, inputToken, outputToken, amount string) (Result, error) {
+	_, hasPool := onchainPools[pairKey(inputToken, outputToken)]
+	if quoterAddress != "" {
+		result, err := fetchQuoterQuote(ctx, inputToken, outputToken, amount)
+		if err == nil || !hasPool {
+			return result, err
+		}
+		log.Printf("[ONCHAIN] Quoter failed for %s to %s, trying pool reserves: %v", inputToken, outputToken, err)
+	}
+	return fetchPoolQuote(ctx, inputToken, outputToken, amount)
+}
+
+// fetchPoolQuote prices amount straight from the pool reserves. The pool is
+// oriented by whichever of the two tokens matches token0/token1, so a native
+// token (mon) on one side works against a pool holding its wrapped form.
+func fetchPoolQuote(ctx context.Context, inputToken, outputToken, amount string) (Result, error) {
+	pool, ok := onchainPools[pairKey(inputToken, outputToken)]
+	if !ok {
+		return Result{}, errNoPool
+	}
+	client, err := getRPCClient()
+	if err != nil {
+		return Result{}, err
+	}
+
+	amountIn, err := parseUnits(amount, tokenChainDecimals[inputToken])
+	if err != nil {
+		return Result{}, err
+	}
+
+	token0, err := callContract(ctx, client, pairABI, pool, "token0")
+	if err != nil {
+		return Result{}, err
+	}
+	token1, err := callContract(ctx, client, pairABI, pool, "token1")
+	if err != nil {
+		return Result{}, err
+	}
+	reserves, err := callContract(ctx, client, pairABI, pool, "getReserves")
+	if err != nil {
+		return Result{}, err
+	}
+
+	reserve0, reserve1 := reserves[0].(*big.Int), reserves[1].(*big.Int)
+	var reserveIn, reserveOut *big.Int
+	switch address0, address1 := token0[0].(common.Address).Hex(), token1[0].(common.Address).Hex(); {
+	case strings.EqualFold(address1, tokenAddresses[outputToken]), strings.EqualFold(address0, tokenAddresses[inputToken]):
+		reserveIn, reserveOut = reserve0, reserve1
+	case strings.EqualFold(address0, tokenAddresses[outputToken]), strings.EqualFold(address1, tokenAddresses[inputToken]):
+		reserveIn, reserveOut = reserve1, reserve0
+	default:
+		return Result{}, fmt.Errorf("pool %s doesn't hold %s or %s", pool.Hex(), inputToken, outputToken)
+	}
+	if reserveIn.Sign() == 0 || reserveOut.Sign() == 0 {
+		return Result{}, fmt.Errorf("pool %s has no liquidity", pool.Hex())
+	}
+
+	amountOut := constantProductOut(amountIn, reserveIn, reserveOut, onchainFeeBps)
+	outputValue, err := weiToDecimal(amountOut.String(), tokenChainDecimals[outputToken])
+	if err != nil {
+		return Result{}, fmt.Errorf("pool %s returns nothing for this amount", pool.Hex())
+	}
+
+	inputAmount, _ := strconv.ParseFloat(amount, 64)
+	outputAmount, _ := strconv.ParseFloat(outputValue, 64)
+	result := buildResult(inputToken, outputToken, inputAmount, outputAmount, scrapedQuote{})
+	result.Source = "rpc"
+	return result, nil
+}
+
+func onchainFallback(inputToken, outputToken, amount string) (Result, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := fetchOnchainQuote(ctx, inputToken, outputToken, amount)
+	if err != nil {
+		if !errors.Is(err, errNoPool) {
+			log.Printf("[ONCHAIN] Fallback quote for %s to %s failed: %v", inputToken, outputToken, err)
+		}
+		return Result{}, false
+	}
+	return result, true
+}
+
+func handleOnchainQuote(c *gin.Context) {
+	inputToken := normalizeToken(c.Query("input"))
+	outputToken := normalizeToken(c.Query("output"))
+	amount := c.Query("amount")
+
+	if inputToken == "" || outputToken == "" || amount == "" {
+		respondError(c, http.StatusBadRequest, CODE_INVALID_PARAMETER, "input, output, and amount parameters are required")
+		return
+	}
+	if _, exists := tokenAddresses[inputToken]; !exists {
+		respondError(c, http.StatusBadRequest, CODE_UNSUPPORTED_TOKEN, "unsupported input token: "+inputToken)
+		return
+	}
+	if _, exists := tokenAddresses[outputToken]; !exists {
+		respondError(c, http.StatusBadRequest, CODE_UNSUPPORTED_TOKEN, "unsupported output token: "+outputToken)
+		return
+	}
+	if sameToken(inputToken, outputToken) {
+		respondError(c, http.StatusBadRequest, CODE_INVALID_PARAMETER, errSameToken.Error())
+		return
+	}
+	amount = canonicalAmount(amount)
+	err := validateAmount(inputToken, amount)
+	if err == nil {
+		// more decimals than the token has can't be sent on chain
+		_, err = parseUnits(amount, tokenChainDecimals[inputToken])
+	}
+	if err != nil {
+		respondError(c, http.StatusBadRequest, CODE_INVALID_AMOUNT, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	result, err := fetchOnchainQuote(ctx, inputToken, outputToken, amount)
+	switch {
+	case errors.Is(err, errNoPool):
+		respondError(c, http.StatusNotFound, CODE_NO_ROUTE, err.Error())
+		return
+	case errors.Is(err, errRPCNotConfigured):
+		respondError(c, http.StatusNotFound, CODE_UNAVAILABLE, err.Error())
+		return
+	case errors.Is(err, context.DeadlineExceeded):
+		respondError(c, http.StatusGatewayTimeout, CODE_UPSTREAM_TIMEOUT, err.Error())
+		return
+	case err != nil:
+		respondError(c, http.StatusBadGateway, CODE_RPC_FAILED, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Priority int
+
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+)
+
+// parsePriority reads the X-Priority request header. An empty value is
+// normal priority.
+func parsePriority(value string) (Priority, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "high":
+		return PriorityHigh, nil
+	case "", "normal":
+		return PriorityNormal, nil
+	case "low":
+		return PriorityLow, nil
+	}
+	return PriorityNormal, fmt.Errorf("X-Priority must be high, normal, or low")
+}
+
+var errPoolSaturated = errors.New("browser pool is saturated, try again shortly")
+
+// BrowserPool bounds how many browsers scrape at once, BROWSER_POOL_SIZE, so a
+// burst of cache misses can't open enough tabs to exhaust memory. Normal- and
+// low-priority work only gets a slot while utilization is under the
+// high-water mark; the slots above it are kept for high-priority work (cache
+// warming, urgent quotes). Work that can't get a slot waits in a bounded
+// queue ordered by priority, first come first served within a level, and is
+// rejected once the queue is full.
+type BrowserPool struct {
+	mutex     sync.Mutex
+	size      int
+	highWater float64
+	maxQueue  int
+	inUse     int
+	waiters   []*poolWaiter
+
+	// autoscaling state, see Autoscale
+	queuedSince time.Time
+	idleSince   time.Time
+}
+
+type poolWaiter struct {
+	priority Priority
+	ready    chan struct{}
+}
+
+func NewBrowserPool(size int, highWater float64, maxQueue int) *BrowserPool {
+	return &BrowserPool{
+		size:      max(size, 1),
+		highWater: math.Min(math.Max(highWater, 0), 1),
+		maxQueue:  max(maxQueue, 0),
+	}
+}
+
+// normalLimit is the number of slots normal-priority work may occupy. At
+// least one slot is always usable.
+func (p *BrowserPool) normalLimit() int {
+	return max(int(math.Floor(float64(p.size)*p.highWater)), 1)
+}
+
+// limit is the number of slots work of the given priority may occupy.
+func (p *BrowserPool) limit(priority Priority) int {
+	if priority >= PriorityHigh {
+		return p.size
+	}
+	return p.normalLimit()
+}
+
+func (p *BrowserPool) Acquire(ctx context.Context, priority Priority) error {
+	p.mutex.Lock()
+	if p.inUse < p.limit(priority) {
+		p.inUse++
+		p.mutex.Unlock()
+		return nil
+	}
+	if len(p.waiters) >= p.maxQueue {
+		p.mutex.Unlock()
+		log.Printf("[POOL] Rejecting scrape: %d of %d browsers in use and %d queued (high-water %.0f%%)", p.inUse, p.size, len(p.waiters), p.highWater*100)
+		return errPoolSaturated
+	}
+
+	ready := &poolWaiter{priority: priority, ready: make(chan struct{})}
+	position := len(p.waiters)
+	for i, waiter := range p.waiters {
+		if waiter.priority < priority {
+			position = i
+			break
+		}
+	}
+	p.waiters = slices.Insert(p.waiters, position, ready)
+	p.mutex.Unlock()
+
+	select {
+	case <-ready.ready:
+		return nil
+	case <-ctx.Done():
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		for i, waiter := range p.waiters {
+			if waiter == ready {
+				p.waiters = append(p.waiters[:i], p.waiters[i+1:]...)
+				return ctx.Err()
+			}
+		}
+		// the slot was handed over while we were giving up, pass it on
+		p.releaseLocked()
+		return ctx.Err()
+	}
+}
+
+func (p *BrowserPool) Release() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.releaseLocked()
+}
+
+// releaseLocked hands the freed slot to the first queued waiter allowed to
+// take it. Waiters are ordered by priority, and normal or low ones are skipped
+// while the slot being freed is above the high-water mark.
+func (p *BrowserPool) releaseLocked() {
+	for i, waiter := range p.waiters {
+		if p.inUse-1 < p.limit(waiter.priority) {
+			p.waiters = slices.Delete(p.waiters, i, i+1)
+			close(waiter.ready)
+			return
+		}
+	}
+	p.inUse--
+}
+
+// dispatchLocked hands free slots to queued waiters allowed to take them,
+// after the pool has grown.
+func (p *BrowserPool) dispatchLocked() {
+	for i := 0; i < len(p.waiters); {
+		waiter := p.waiters[i]
+		if p.inUse >= p.limit(waiter.priority) {
+			i++
+			continue
+		}
+		p.inUse++
+		p.waiters = slices.Delete(p.waiters, i, i+1)
+		close(waiter.ready)
+	}
+}
+
+// scale grows the pool by one slot once work has been queued for
+// scaleUpAfter, and shrinks it by one once a slot has gone unused for
+// idleTimeout, staying within [minSize, maxSize].
+func (p *BrowserPool) scale(now time.Time, minSize, maxSize int, scaleUpAfter, idleTimeout time.Duration) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if len(p.waiters) == 0 {
+		p.queuedSince = time.Time{}
+	} else if p.queuedSince.IsZero() {
+		p.queuedSince = now
+	} else if now.Sub(p.queuedSince) >= scaleUpAfter && p.size < maxSize {
+		p.size++
+		p.queuedSince = now
+		log.Printf("[POOL] Scaled up to %d browsers, %d scrapes queued", p.size, len(p.waiters))
+		p.dispatchLocked()
+	}
+
+	if p.inUse >= p.size {
+		p.idleSince = time.Time{}
+	} else if p.idleSince.IsZero() {
+		p.idleSince = now
+	} else if now.Sub(p.idleSince) >= idleTimeout && p.size > minSize {
+		p.size--
+		p.idleSince = now
+		log.Printf("[POOL] Scaled down to %d browsers after %v idle", p.size, idleTimeout)
+	}
+}
+
+// Pool autoscaling. The pool starts at BROWSER_POOL_SIZE and moves between
+// BROWSER_POOL_MIN and BROWSER_POOL_MAX, which both default to that size, so
+// scaling is off unless a range is configured. Tabs are opened per scrape and
+// closed afterwards, so a smaller pool also means fewer live tabs.
+var (
+	poolMinSize      = envInt("BROWSER_POOL_MIN", envInt("BROWSER_POOL_SIZE", 4))
+	poolMaxSize      = envInt("BROWSER_POOL_MAX", envInt("BROWSER_POOL_SIZE", 4))
+	poolScaleUpAfter = envDuration("POOL_SCALE_UP_AFTER", 10*time.Second)
+	poolIdleTimeout  = envDuration("POOL_IDLE_TIMEOUT", 5*time.Minute)
+)
+
+const POOL_SCALE_INTERVAL = time.Second
+
+func (p *BrowserPool) Autoscale(ctx context.Context) {
+	minSize, maxSize := max(poolMinSize, 1), max(poolMaxSize, 1)
+	if minSize >= maxSize {
+		return
+	}
+
+	ticker := time.NewTicker(POOL_SCALE_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			p.scale(now, minSize, maxSize, poolScaleUpAfter, poolIdleTimeout)
+		}
+	}
+}
+
+func (p *BrowserPool) InUse() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.inUse
+}
+
+// QueueDepth is the number of scrapes waiting for a slot.
+func (p *BrowserPool) QueueDepth() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return len(p.waiters)
+}
+
+func (p *BrowserPool) Utilization() float64 {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return float64(p.inUse) / float64(p.size)
+}
+
+var browserPool = NewBrowserPool(envInt("BROWSER_POOL_SIZE", 4), envFloat("POOL_HIGH_WATER", 0.9), envInt("POOL_MAX_QUEUE", 32))
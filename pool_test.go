@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBrowserPoolServesInArrivalOrder(t *testing.T) {
+	pool := NewBrowserPool(1, 1, 2)
+	if err := pool.Acquire(context.Background(), PriorityNormal); err != nil {
+		t.Fatal(err)
+	}
+
+	served := make(chan int, 2)
+	for i := range 2 {
+		go func() {
+			if err := pool.Acquire(context.Background(), PriorityNormal); err == nil {
+				served <- i
+			}
+		}()
+		// queue them one after the other
+		for deadline := time.Now().Add(time.Second); pool.QueueDepth() <= i; {
+			if time.Now().After(deadline) {
+				t.Fatalf("waiter %d never queued", i)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	if err := pool.Acquire(context.Background(), PriorityNormal); err != errPoolSaturated {
+		t.Errorf("Acquire on a full queue = %v, want errPoolSaturated", err)
+	}
+
+	for want := range 2 {
+		pool.Release()
+		if got := <-served; got != want {
+			t.Errorf("waiter %d served before waiter %d", got, want)
+		}
+	}
+	if depth := pool.QueueDepth(); depth != 0 {
+		t.Errorf("QueueDepth() = %d after serving everyone, want 0", depth)
+	}
+}
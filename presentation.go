@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// RatePresentation rescales a pair's exchange rate into a unit people can
+// read, e.g. usdc->wbtc as "sats per usdc" with a scale of 1e8 instead of a
+// rate like 0.00001.
+type RatePresentation struct {
+	Unit  string  `json:"unit"`
+	Scale float64 `json:"scale"`
+}
+
+// ratePresentations is read from RATE_PRESENTATION, a JSON object keyed by
+// "input/output", e.g. {"usdc/wbtc": {"unit": "sats per usdc", "scale": 1e8}}.
+var ratePresentations map[string]RatePresentation
+
+func parseRatePresentations(value string) (map[string]RatePresentation, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var presentations map[string]RatePresentation
+	if err := json.Unmarshal([]byte(value), &presentations); err != nil {
+		return nil, fmt.Errorf("invalid RATE_PRESENTATION: %w", err)
+	}
+	for pair, presentation := range presentations {
+		if presentation.Scale <= 0 {
+			return nil, fmt.Errorf("RATE_PRESENTATION for %s needs a positive scale", pair)
+		}
+	}
+	return presentations, nil
+}
+
+// applyRatePresentation fills in the display rate from the unrounded output so
+// high-value outputs don't collapse to a near-zero rate.
+func applyRatePresentation(result Result) Result {
+	presentation, ok := ratePresentations[pairKey(result.Input.Token, result.Output.Token)]
+	if !ok || result.Input.Amount == 0 {
+		return result
+	}
+
+	output := result.Output.Amount
+	if result.rawOutputAmount != 0 {
+		output = result.rawOutputAmount
+	}
+	result.DisplayRate = output / result.Input.Amount * presentation.Scale
+	result.DisplayRateUnit = presentation.Unit
+	return result
+}
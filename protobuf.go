@@ -0,0 +1,139 @@
+package main
+
+import (
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const PROTOBUF_CONTENT_TYPE = "application/x-protobuf"
+
+// marshalResultProto encodes result as the Result message in result.proto.
+// Zero values are skipped, matching proto3 defaults.
+func marshalResultProto(result Result) []byte {
+	var b []byte
+
+	b = appendMessage(b, 1, appendTokenAmount(nil, result.Input.Amount, result.Input.Token))
+	b = appendMessage(b, 2, appendTokenAmount(nil, result.Output.Amount, result.Output.Token))
+	b = appendDouble(b, 3, result.ExchangeRate)
+	b = appendString(b, 4, result.Timestamp)
+	b = appendDouble(b, 5, result.NormalizedRate)
+	b = appendDouble(b, 6, result.GrossExchangeRate)
+	if result.Fee != nil {
+		var fee []byte
+		fee = appendDouble(fee, 1, result.Fee.Amount)
+		fee = appendString(fee, 2, result.Fee.Token)
+		fee = appendDouble(fee, 3, result.Fee.Bps)
+		b = appendMessage(b, 7, fee)
+	}
+	b = appendString(b, 8, result.QuotedDirection)
+	b = appendDouble(b, 9, result.RequestedAmount)
+	b = appendString(b, 10, result.Mirror)
+	b = appendBool(b, 11, result.PrecisionExtended)
+	b = appendString(b, 12, result.InputWei)
+	b = appendString(b, 13, result.OutputWei)
+	b = appendString(b, 14, result.Source)
+	b = appendDouble(b, 15, result.InputUSDValue)
+	b = appendDouble(b, 16, result.DisplayRate)
+	b = appendString(b, 17, result.DisplayRateUnit)
+	if result.EffectiveSlippageBps != nil {
+		// optional field, so an explicit zero is still written
+		b = protowire.AppendTag(b, 18, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(*result.EffectiveSlippageBps))
+	}
+	if result.Signature != nil {
+		var signature []byte
+		signature = appendString(signature, 1, result.Signature.Payload)
+		signature = appendString(signature, 2, result.Signature.Signature)
+		signature = appendString(signature, 3, result.Signature.Signer)
+		b = appendMessage(b, 19, signature)
+	}
+	b = appendBool(b, 20, result.Stale)
+	b = appendUint(b, 21, result.Sequence)
+	b = appendDouble(b, 22, result.GrossOutputAmount)
+	b = appendDouble(b, 23, result.TransferFeeBps)
+	if result.Precision != nil {
+		var precision []byte
+		precision = appendUint(precision, 1, uint64(result.Precision.Input))
+		precision = appendUint(precision, 2, uint64(result.Precision.Output))
+		precision = appendUint(precision, 3, uint64(result.Precision.Rate))
+		b = appendMessage(b, 24, precision)
+	}
+	b = appendString(b, 25, result.InputAddress)
+	b = appendString(b, 26, result.OutputAddress)
+	b = appendDouble(b, 27, result.Confidence)
+	b = appendDouble(b, 28, result.ScaledFrom)
+	if result.PriceImpact != nil {
+		b = protowire.AppendTag(b, 29, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(*result.PriceImpact))
+	}
+	b = appendBool(b, 30, result.Estimated)
+	if result.Reverse != nil {
+		b = appendMessage(b, 31, marshalResultProto(*result.Reverse))
+	}
+	b = appendDouble(b, 32, result.ReciprocalRate)
+	if result.Debug != nil {
+		var debug []byte
+		debug = appendString(debug, 1, result.Debug.RawInput)
+		debug = appendString(debug, 2, result.Debug.RawOutput)
+		debug = appendString(debug, 3, result.Debug.RawFee)
+		debug = appendString(debug, 4, result.Debug.RawPriceImpact)
+		debug = appendDouble(debug, 5, result.Debug.RawOutputAmount)
+		debug = appendUint(debug, 6, uint64(result.Debug.DecimalPlaces))
+		debug = appendUint(debug, 7, uint64(result.Debug.Attempts))
+		b = appendMessage(b, 33, debug)
+	}
+	if result.UnixTimestamp != 0 {
+		b = protowire.AppendTag(b, 34, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(result.UnixTimestamp))
+	}
+	b = appendDouble(b, 35, result.OutputUSD)
+	b = appendString(b, 36, result.Mode)
+	b = appendDouble(b, 37, result.SpotPrice)
+	b = appendDouble(b, 38, result.AgeSeconds)
+	b = appendString(b, 39, result.Side)
+
+	return b
+}
+
+func appendTokenAmount(b []byte, amount float64, token string) []byte {
+	b = appendDouble(b, 1, amount)
+	return appendString(b, 2, token)
+}
+
+func appendDouble(b []byte, field protowire.Number, value float64) []byte {
+	if value == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, field, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, math.Float64bits(value))
+}
+
+func appendUint(b []byte, field protowire.Number, value uint64) []byte {
+	if value == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, field, protowire.VarintType)
+	return protowire.AppendVarint(b, value)
+}
+
+func appendBool(b []byte, field protowire.Number, value bool) []byte {
+	if !value {
+		return b
+	}
+	b = protowire.AppendTag(b, field, protowire.VarintType)
+	return protowire.AppendVarint(b, 1)
+}
+
+func appendString(b []byte, field protowire.Number, value string) []byte {
+	if value == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, field, protowire.BytesType)
+	return protowire.AppendString(b, value)
+}
+
+func appendMessage(b []byte, field protowire.Number, message []byte) []byte {
+	b = protowire.AppendTag(b, field, protowire.BytesType)
+	return protowire.AppendBytes(b, message)
+}
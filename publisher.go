@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Quote events. When PUBLISH_URL points at a NATS server, every freshly
+// scraped quote is published as JSON to PUBLISH_SUBJECT.<input>.<output>, so
+// consumers can subscribe to one pair or use wildcards for all of them.
+var (
+	publishURL     = envString("PUBLISH_URL", "")
+	publishSubject = envString("PUBLISH_SUBJECT", "prices")
+)
+
+var (
+	publisherOnce sync.Once
+	publisherConn *nats.Conn
+)
+
+// getPublisher connects on first use. nats.go buffers and reconnects on its
+// own, so a broker outage never blocks a scrape.
+func getPublisher() *nats.Conn {
+	publisherOnce.Do(func() {
+		if publishURL == "" {
+			return
+		}
+		conn, err := nats.Connect(publishURL,
+			nats.Name("monad-price-token"),
+			nats.RetryOnFailedConnect(true),
+			nats.MaxReconnects(-1),
+		)
+		if err != nil {
+			log.Printf("[PUBLISH] Failed to connect to %s: %v", publishURL, err)
+			return
+		}
+		log.Printf("[PUBLISH] Publishing quotes to %s under %s", publishURL, publishSubject)
+		publisherConn = conn
+	})
+	return publisherConn
+}
+
+func publishQuote(inputToken, outputToken string, result Result) {
+	conn := getPublisher()
+	if conn == nil {
+		return
+	}
+
+	payload, err := json.Marshal(result)
+	if err != nil {
+		log.Printf("[PUBLISH] Failed to encode %s quote: %v", pairKey(inputToken, outputToken), err)
+		return
+	}
+	if err := conn.Publish(publishSubject+"."+inputToken+"."+outputToken, payload); err != nil {
+		log.Printf("[PUBLISH] Failed to publish %s quote: %v", pairKey(inputToken, outputToken), err)
+	}
+}
+
+// closePublisher flushes quotes still buffered for the broker.
+func closePublisher() {
+	if publisherConn == nil {
+		return
+	}
+	if err := publisherConn.Drain(); err != nil {
+		log.Printf("[PUBLISH] Failed to drain: %v", err)
+	}
+}
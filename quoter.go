@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const UNISWAP_V2_ROUTER_ABI = `[
+	{"name":"getAmountsOut","type":"function","stateMutability":"view","inputs":[
+		{"name":"amountIn","type":"uint256"},
+		{"name":"path","type":"address[]"}
+	],"outputs":[{"name":"amounts","type":"uint256[]"}]}
+]`
+
+// The quoter contract asked for an output amount over RPC when scraping
+// fails, before falling back to ONCHAIN_POOLS reserves. QUOTER_METHOD in
+// QUOTER_ABI must take either (uint256 amountIn, address[] path), like a
+// UniswapV2 router's getAmountsOut, or (address tokenIn, address tokenOut,
+// uint256 amountIn), and return the output amount first (or last, for an
+// array of amounts).
+var (
+	quoterAddress string
+	quoterABI     abi.ABI
+	quoterMethod  = envString("QUOTER_METHOD", "getAmountsOut")
+)
+
+var errNoQuoter = errors.New("QUOTER_ADDRESS is not configured")
+
+func parseQuoterAddress(value string) (string, error) {
+	if value != "" && !common.IsHexAddress(value) {
+		return "", fmt.Errorf("QUOTER_ADDRESS is not an address: %s", value)
+	}
+	return value, nil
+}
+
+func parseQuoterABI(definition string) (abi.ABI, error) {
+	parsed, err := abi.JSON(strings.NewReader(definition))
+	if err != nil {
+		return abi.ABI{}, fmt.Errorf("invalid QUOTER_ABI: %w", err)
+	}
+	return parsed, nil
+}
+
+func quoterArgs(method abi.Method, amountIn *big.Int, tokenIn, tokenOut common.Address) ([]interface{}, error) {
+	inputs := method.Inputs
+	switch {
+	case len(inputs) == 2 && inputs[0].Type.T == abi.UintTy && inputs[1].Type.T == abi.SliceTy:
+		return []interface{}{amountIn, []common.Address{tokenIn, tokenOut}}, nil
+	case len(inputs) == 3 && inputs[0].Type.T == abi.AddressTy && inputs[1].Type.T == abi.AddressTy && inputs[2].Type.T == abi.UintTy:
+		return []interface{}{tokenIn, tokenOut, amountIn}, nil
+	}
+	return nil, fmt.Errorf("QUOTER_METHOD %s has an unsupported signature %s", method.Name, method.Sig)
+}
+
+func quoterAmountOut(values []interface{}) (*big.Int, error) {
+	if len(values) > 0 {
+		switch value := values[0].(type) {
+		case *big.Int:
+			return value, nil
+		case []*big.Int:
+			if len(value) > 0 {
+				return value[len(value)-1], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%s() returned no output amount", quoterMethod)
+}
+
+// fetchQuoterQuote asks the QUOTER_ADDRESS contract how much outputToken
+// amount of inputToken swaps for.
+func fetchQuoterQuote(ctx context.Context, inputToken, outputToken, amount string) (Result, error) {
+	if quoterAddress == "" {
+		return Result{}, errNoQuoter
+	}
+	method, ok := quoterABI.Methods[quoterMethod]
+	if !ok {
+		return Result{}, fmt.Errorf("QUOTER_ABI has no method %s", quoterMethod)
+	}
+	client, err := getRPCClient()
+	if err != nil {
+		return Result{}, err
+	}
+
+	amountIn, err := parseUnits(amount, tokenChainDecimals[inputToken])
+	if err != nil {
+		return Result{}, err
+	}
+	args, err := quoterArgs(method, amountIn, common.HexToAddress(tokenAddresses[inputToken]), common.HexToAddress(tokenAddresses[outputToken]))
+	if err != nil {
+		return Result{}, err
+	}
+
+	values, err := callContract(ctx, client, quoterABI, common.HexToAddress(quoterAddress), quoterMethod, args...)
+	if err != nil {
+		return Result{}, err
+	}
+	amountOut, err := quoterAmountOut(values)
+	if err != nil {
+		return Result{}, err
+	}
+	outputValue, err := weiToDecimal(amountOut.String(), tokenChainDecimals[outputToken])
+	if err != nil {
+		return Result{}, fmt.Errorf("quoter returns nothing for this amount")
+	}
+
+	inputAmount, _ := strconv.ParseFloat(amount, 64)
+	outputAmount, _ := strconv.ParseFloat(outputValue, 64)
+	result := buildResult(inputToken, outputToken, inputAmount, outputAmount, scrapedQuote{})
+	result.Source = "rpc"
+	return result, nil
+}
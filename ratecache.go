@@ -0,0 +1,126 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rateCachePairs lists "input/output" pairs from RATE_CACHE_PAIRS (comma
+// separated, "*" for every pair) that are cached as a single rate per pair
+// instead of a quote per amount. Any amount is then served by scaling the
+// latest quote of the pair, whatever amount it was taken at, which keeps
+// memory flat for clients asking for many different amounts at the cost of
+// ignoring price impact between them.
+var rateCachePairs = parsePairSet(envString("RATE_CACHE_PAIRS", ""))
+
+func rateCached(inputToken, outputToken string) bool {
+	return rateCachePairs["*"] || rateCachePairs[pairKey(inputToken, outputToken)]
+}
+
+// storedCacheKey is the key storeQuote files a quote under, the pair alone for
+// rate-cached pairs.
+func storedCacheKey(inputToken, outputToken, amount string) string {
+	if rateCached(inputToken, outputToken) {
+		return pairKey(inputToken, outputToken)
+	}
+	return cacheKey(inputToken, outputToken, amount)
+}
+
+// RateCache holds the latest quote of each pair, keyed by pair alone.
+type RateCache struct {
+	mutex   sync.RWMutex
+	entries map[string]CacheEntry
+}
+
+func NewRateCache() *RateCache {
+	return &RateCache{entries: make(map[string]CacheEntry)}
+}
+
+var rateCache = NewRateCache()
+
+func (c *RateCache) Get(inputToken, outputToken string) (Result, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	entry, ok := c.entries[pairKey(inputToken, outputToken)]
+	if !ok || time.Now().After(entry.ExpiresAt) {
+		return Result{}, false
+	}
+	return entry.served(), true
+}
+
+// Quote synthesizes a quote for amount from the pair's cached rate.
+func (c *RateCache) Quote(inputToken, outputToken, amount string) (Result, bool) {
+	base, ok := c.Get(inputToken, outputToken)
+	if !ok || isInvalidResult(base) {
+		return Result{}, false
+	}
+	inputAmount, err := strconv.ParseFloat(amount, 64)
+	if err != nil || inputAmount <= 0 {
+		return Result{}, false
+	}
+	if inputAmount == base.Input.Amount {
+		return base, true
+	}
+	return scaleResult(base, inputAmount), true
+}
+
+// Set stores result as the pair's rate unless a newer quote is already there.
+func (c *RateCache) Set(inputToken, outputToken string, result Result) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	key := pairKey(inputToken, outputToken)
+	if existing, ok := c.entries[key]; ok && newerResult(existing.Result, result) {
+		return
+	}
+	now := time.Now()
+	c.entries[key] = CacheEntry{Result: result, CreatedAt: now, ExpiresAt: now.Add(cacheTTL)}
+}
+
+func (c *RateCache) Len() int {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return len(c.entries)
+}
+
+// Sweep deletes rates that expired more than retain ago.
+func (c *RateCache) Sweep(retain time.Duration) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	cutoff := time.Now().Add(-retain)
+	removed := 0
+	for key, entry := range c.entries {
+		if entry.ExpiresAt.Before(cutoff) {
+			delete(c.entries, key)
+			removed++
+		}
+	}
+	return removed
+}
+
+// EvictToken removes every rate with token on either side.
+func (c *RateCache) EvictToken(token string) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	removed := 0
+	for key, entry := range c.entries {
+		if entry.Result.Input.Token == token || entry.Result.Output.Token == token {
+			delete(c.entries, key)
+			removed++
+		}
+	}
+	return removed
+}
+
+func (c *RateCache) Flush() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	removed := len(c.entries)
+	c.entries = make(map[string]CacheEntry)
+	return removed
+}
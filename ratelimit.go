@@ -0,0 +1,130 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Per-client rate limiting. Each client IP gets a token bucket refilled at
+// RATE_LIMIT_PER_MINUTE (default 60, 0 turns limiting off) holding up to
+// RATE_LIMIT_BURST requests (default the per-minute rate). With
+// RATE_LIMIT_EXEMPT_CACHE_HITS (default true) a request answered from the
+// cache gets its token back, since only scrapes are expensive.
+var (
+	rateLimitPerMinute       = envFloat("RATE_LIMIT_PER_MINUTE", 60)
+	rateLimitBurst           = envFloat("RATE_LIMIT_BURST", rateLimitPerMinute)
+	rateLimitExemptCacheHits = envBool("RATE_LIMIT_EXEMPT_CACHE_HITS", true)
+)
+
+const RATE_LIMIT_IDLE_EXPIRY = 10 * time.Minute
+
+// rateLimitExempt are routes monitors and scrapers of our own poll.
+var rateLimitExempt = map[string]bool{
+	"/ping":    true,
+	"/health":  true,
+	"/metrics": true,
+}
+
+type tokenBucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+type RateLimiter struct {
+	mutex     sync.Mutex
+	perSecond float64
+	burst     float64
+	buckets   map[string]*tokenBucket
+	lastPrune time.Time
+}
+
+func NewRateLimiter(perMinute, burst float64) *RateLimiter {
+	return &RateLimiter{
+		perSecond: perMinute / 60,
+		burst:     math.Max(burst, 1),
+		buckets:   make(map[string]*tokenBucket),
+		lastPrune: time.Now(),
+	}
+}
+
+// Allow takes a token from the client's bucket. When the bucket is empty it
+// returns how long until the next token.
+func (l *RateLimiter) Allow(client string) (bool, time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+	l.pruneLocked(now)
+
+	bucket, ok := l.buckets[client]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.burst, lastSeen: now}
+		l.buckets[client] = bucket
+	}
+	bucket.tokens = math.Min(l.burst, bucket.tokens+now.Sub(bucket.lastSeen).Seconds()*l.perSecond)
+	bucket.lastSeen = now
+
+	if bucket.tokens < 1 {
+		wait := time.Duration((1 - bucket.tokens) / l.perSecond * float64(time.Second))
+		return false, wait
+	}
+	bucket.tokens--
+	return true, 0
+}
+
+// Refund gives a token back, for requests that turned out to be cheap.
+func (l *RateLimiter) Refund(client string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if bucket, ok := l.buckets[client]; ok {
+		bucket.tokens = math.Min(l.burst, bucket.tokens+1)
+	}
+}
+
+// pruneLocked drops buckets of clients not seen for a while, which are full
+// again anyway.
+func (l *RateLimiter) pruneLocked(now time.Time) {
+	if now.Sub(l.lastPrune) < RATE_LIMIT_IDLE_EXPIRY {
+		return
+	}
+	for client, bucket := range l.buckets {
+		if now.Sub(bucket.lastSeen) > RATE_LIMIT_IDLE_EXPIRY {
+			delete(l.buckets, client)
+		}
+	}
+	l.lastPrune = now
+}
+
+var rateLimiter = NewRateLimiter(rateLimitPerMinute, rateLimitBurst)
+
+// CACHE_HIT_KEY is set on the gin context by handlers that answered from the
+// cache.
+const CACHE_HIT_KEY = "cache_hit"
+
+func rateLimit(c *gin.Context) {
+	if rateLimitPerMinute <= 0 || rateLimitExempt[c.FullPath()] {
+		c.Next()
+		return
+	}
+
+	client := c.ClientIP()
+	allowed, wait := rateLimiter.Allow(client)
+	if !allowed {
+		retryAfter := strconv.Itoa(int(math.Ceil(wait.Seconds())))
+		c.Header("Retry-After", retryAfter)
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded, retry in " + retryAfter + "s"})
+		return
+	}
+
+	c.Next()
+
+	if rateLimitExemptCacheHits && c.GetBool(CACHE_HIT_KEY) {
+		rateLimiter.Refund(client)
+	}
+}
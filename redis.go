@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const REDIS_KEY_PREFIX = "kuru:quote:"
+
+var (
+	redisURL     = envString("REDIS_URL", "")
+	redisTimeout = envDuration("REDIS_TIMEOUT", 500*time.Millisecond)
+)
+
+// RedisCache stores quotes as JSON under kuru:quote:<input>/<output>/<amount>
+// with the cache TTL as the key's expiry. Redis errors are logged and treated
+// as misses, so an outage only costs scrapes.
+type RedisCache struct {
+	client *redis.Client
+}
+
+func newRedisCache(url string) (*RedisCache, error) {
+	options, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisCache{client: redis.NewClient(options)}, nil
+}
+
+func redisKey(inputToken, outputToken, amount string) string {
+	return REDIS_KEY_PREFIX + cacheKey(inputToken, outputToken, amount)
+}
+
+func (r *RedisCache) Get(inputToken, outputToken, amount string) (Result, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	payload, err := r.client.Get(ctx, redisKey(inputToken, outputToken, amount)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return Result{}, false
+	}
+	if err != nil {
+		log.Printf("[REDIS] Get %s failed: %v", cacheKey(inputToken, outputToken, amount), err)
+		return Result{}, false
+	}
+
+	var result Result
+	if err := json.Unmarshal(payload, &result); err != nil {
+		log.Printf("[REDIS] Discarding unreadable entry %s: %v", cacheKey(inputToken, outputToken, amount), err)
+		return Result{}, false
+	}
+	return result, true
+}
+
+func (r *RedisCache) Set(inputToken, outputToken, amount string, result Result) {
+	payload, err := json.Marshal(result)
+	if err != nil {
+		log.Printf("[REDIS] Failed to encode %s: %v", cacheKey(inputToken, outputToken, amount), err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := r.client.Set(ctx, redisKey(inputToken, outputToken, amount), payload, cacheTTL).Err(); err != nil {
+		log.Printf("[REDIS] Set %s failed: %v", cacheKey(inputToken, outputToken, amount), err)
+	}
+}
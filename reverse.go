@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+)
+
+// startReverseQuote quotes outputToken back to inputToken for amount in the
+// background so it overlaps the forward quote. The returned function waits
+// for it and yields nil when the reverse direction could not be quoted.
+func startReverseQuote(ctx context.Context, inputToken, outputToken, amount string, fresh bool) func() *Result {
+	done := make(chan *Result, 1)
+	go func() {
+		result, _, err := resolveQuote(ctx, outputToken, inputToken, amount, fresh)
+		if err != nil {
+			loggerFrom(ctx).Warn("reverse quote failed",
+				"input", outputToken,
+				"output", inputToken,
+				"amount", amount,
+				"error", err,
+			)
+			done <- nil
+			return
+		}
+		done <- &result
+	}()
+	return func() *Result { return <-done }
+}
+
+// reciprocalRate inverts the forward rate. It is only an approximation of
+// the reverse direction: slippage and fees on the opposite swap are ignored.
+func reciprocalRate(result Result) float64 {
+	if result.ExchangeRate == 0 {
+		return 0
+	}
+	return 1 / result.ExchangeRate
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+const MAX_SIG_FIGS = 15
+
+// rateSigFigs, RATE_SIG_FIGS, is how many significant figures exchange rates
+// are rounded to wherever they are computed, so a rate like
+// 5.033333333333334 comes out as 5.033333333. Zero keeps full float
+// precision.
+var rateSigFigs int
+
+func parseRateSigFigs(sigFigs int) (int, error) {
+	if sigFigs < 0 || sigFigs > MAX_SIG_FIGS {
+		return 0, fmt.Errorf("RATE_SIG_FIGS must be between 0 and %d", MAX_SIG_FIGS)
+	}
+	return sigFigs, nil
+}
+
+// exchangeRate is output per unit of input, rounded to RATE_SIG_FIGS. It is 0
+// rather than Inf or NaN when there is no input to divide by.
+func exchangeRate(outputAmount, inputAmount float64) float64 {
+	return exchangeRateSigFigs(outputAmount, inputAmount, rateSigFigs)
+}
+
+func exchangeRateSigFigs(outputAmount, inputAmount float64, sigFigs int) float64 {
+	if inputAmount == 0 {
+		return 0
+	}
+	rate := outputAmount / inputAmount
+	if sigFigs > 0 {
+		rate = roundSigFigs(rate, sigFigs)
+	}
+	return rate
+}
+
+func roundSigFigs(value float64, sigFigs int) float64 {
+	if value == 0 || math.IsNaN(value) || math.IsInf(value, 0) {
+		return value
+	}
+	factor := math.Pow10(sigFigDecimals(value, sigFigs))
+	return math.Round(value*factor) / factor
+}
+
+// sigFigDecimals is the number of decimal places roundSigFigs keeps, negative
+// when it rounds to tens or more.
+func sigFigDecimals(value float64, sigFigs int) int {
+	if value == 0 || math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0
+	}
+	return sigFigs - int(math.Ceil(math.Log10(math.Abs(value))))
+}
+
+func parseSigFigs(value string) (int, error) {
+	sigFigs, err := strconv.Atoi(value)
+	if err != nil || sigFigs < 1 || sigFigs > MAX_SIG_FIGS {
+		return 0, fmt.Errorf("sig_figs must be an integer between 1 and %d", MAX_SIG_FIGS)
+	}
+	return sigFigs, nil
+}
+
+// applySigFigs rounds the output and rates to sigFigs significant figures,
+// starting from the unrounded scraped output rather than the value already
+// floored to the token's decimal places.
+func applySigFigs(result Result, sigFigs int) Result {
+	output := result.Output.Amount
+	if result.rawOutputAmount != 0 {
+		output = result.rawOutputAmount
+	}
+
+	result.Output.Amount = roundSigFigs(output, sigFigs)
+	result.ExchangeRate = exchangeRateSigFigs(output, result.Input.Amount, sigFigs)
+	result.NormalizedRate = roundSigFigs(result.NormalizedRate, sigFigs)
+	result.GrossExchangeRate = roundSigFigs(result.GrossExchangeRate, sigFigs)
+	result.PrecisionExtended = false
+	if result.Precision != nil {
+		precision := *result.Precision
+		precision.Output = max(sigFigDecimals(result.Output.Amount, sigFigs), 0)
+		precision.Rate = max(sigFigDecimals(result.ExchangeRate, sigFigs), 0)
+		result.Precision = &precision
+	}
+	return result
+}
+
+const MAX_RESPONSE_DECIMALS = 18
+
+func parseDecimals(value string) (int, error) {
+	decimals, err := strconv.Atoi(value)
+	if err != nil || decimals < 0 || decimals > MAX_RESPONSE_DECIMALS {
+		return 0, fmt.Errorf("decimals must be an integer between 0 and %d", MAX_RESPONSE_DECIMALS)
+	}
+	return decimals, nil
+}
+
+// Rounding modes for the output amount, chosen with ?rounding=. Quotes are
+// floored by default so the output is never overstated; "none" reports the
+// scraped value as parsed, at full float precision.
+const (
+	ROUNDING_FLOOR = "floor"
+	ROUNDING_ROUND = "round"
+	ROUNDING_CEIL  = "ceil"
+	ROUNDING_NONE  = "none"
+)
+
+func parseRounding(value string) (string, error) {
+	switch value {
+	case ROUNDING_FLOOR, ROUNDING_ROUND, ROUNDING_CEIL, ROUNDING_NONE:
+		return value, nil
+	}
+	return "", fmt.Errorf("rounding must be %s, %s, %s or %s", ROUNDING_FLOOR, ROUNDING_ROUND, ROUNDING_CEIL, ROUNDING_NONE)
+}
+
+func roundDecimals(value float64, decimals int, mode string) float64 {
+	factor := math.Pow10(decimals)
+	scaled := value * factor
+	switch mode {
+	case ROUNDING_ROUND:
+		return math.Round(scaled) / factor
+	case ROUNDING_CEIL:
+		// 1.1*10 is 11.000000000000002 in floating point, which must not
+		// round up to 12
+		if nearest := math.Round(scaled); math.Abs(scaled-nearest) < 1e-9*max(1, math.Abs(scaled)) {
+			return nearest / factor
+		}
+		return math.Ceil(scaled) / factor
+	case ROUNDING_NONE:
+		return value
+	}
+	return math.Floor(scaled) / factor
+}
+
+// outputDecimals is how many decimal places the result's output is shown with.
+func outputDecimals(result Result) int {
+	if result.Precision != nil {
+		return result.Precision.Output
+	}
+	return outputDecimalPlaces(result.Output.Token)
+}
+
+// applyDecimals rounds the output to the requested decimal places instead of
+// the token's default, starting from the unrounded scraped output. Quotes
+// that only carry the already floored output, such as ones read back from
+// Redis, are rounded from that.
+func applyDecimals(result Result, decimals int, mode string) Result {
+	output := result.Output.Amount
+	if result.rawOutputAmount != 0 {
+		output = result.rawOutputAmount
+	}
+
+	result.Output.Amount = roundDecimals(output, decimals, mode)
+	result.ExchangeRate = exchangeRate(result.Output.Amount, result.Input.Amount)
+	result.PrecisionExtended = false
+	if mode == ROUNDING_NONE {
+		return result
+	}
+	if result.Precision != nil {
+		precision := *result.Precision
+		precision.Output, precision.Rate = decimals, decimals
+		result.Precision = &precision
+	}
+	return result
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRoundDecimals(t *testing.T) {
+	tests := []struct {
+		value float64
+		mode  string
+		want  float64
+	}{
+		{1.2345, ROUNDING_FLOOR, 1.23},
+		{1.2355, ROUNDING_ROUND, 1.24},
+		{1.2301, ROUNDING_CEIL, 1.24},
+		{1.1, ROUNDING_CEIL, 1.1},
+		{1.23456789, ROUNDING_NONE, 1.23456789},
+	}
+	for _, tt := range tests {
+		if got := roundDecimals(tt.value, 2, tt.mode); got != tt.want {
+			t.Errorf("roundDecimals(%v, 2, %s) = %v, want %v", tt.value, tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestExchangeRate(t *testing.T) {
+	if got := exchangeRate(15.1, 3); got != 5.033333333 {
+		t.Errorf("exchangeRate(15.1, 3) = %v, want 5.033333333", got)
+	}
+	if got := exchangeRate(1, 0); got != 0 {
+		t.Errorf("exchangeRate(1, 0) = %v, want 0", got)
+	}
+	if _, _, err := parseQuote("mon", "usdc", scrapedQuote{inputValue: "0", outputValue: "3"}); !errors.Is(err, errZeroInput) {
+		t.Errorf("parseQuote with a zero input = %v, want errZeroInput", err)
+	}
+}
+
+func TestApplySigFigs(t *testing.T) {
+	result := liveResult("mon", "usdc", 3, 15.1)
+	result.Precision = &Precision{Input: 4, Output: 6, Rate: 6}
+
+	got := applySigFigs(result, 3)
+	if got.Output.Amount != 15.1 || got.ExchangeRate != 5.03 {
+		t.Errorf("output %v at rate %v, want 15.1 at 5.03", got.Output.Amount, got.ExchangeRate)
+	}
+	if *got.Precision != (Precision{Input: 4, Output: 1, Rate: 2}) {
+		t.Errorf("precision = %+v, want the decimals left after rounding", *got.Precision)
+	}
+}
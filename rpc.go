@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+const ERC20_METADATA_ABI = `[
+	{"name":"name","type":"function","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"string"}]},
+	{"name":"symbol","type":"function","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"string"}]},
+	{"name":"decimals","type":"function","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"uint8"}]}
+]`
+
+var errRPCNotConfigured = errors.New("MONAD_RPC_URL is not configured")
+
+// rpcURL is the Monad JSON-RPC endpoint, MONAD_RPC_URL, or RPC_URL as it used
+// to be called.
+var (
+	rpcURL    = envString("MONAD_RPC_URL", envString("RPC_URL", ""))
+	rpcOnce   sync.Once
+	rpcClient *ethclient.Client
+	rpcErr    error
+	erc20ABI  = mustParseABI(ERC20_METADATA_ABI)
+)
+
+func mustParseABI(definition string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(definition))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
+
+func getRPCClient() (*ethclient.Client, error) {
+	if rpcURL == "" {
+		return nil, errRPCNotConfigured
+	}
+	rpcOnce.Do(func() {
+		rpcClient, rpcErr = ethclient.Dial(rpcURL)
+	})
+	return rpcClient, rpcErr
+}
+
+// callContract packs a call against contractABI, executes it at the latest
+// block and unpacks the outputs.
+func callContract(ctx context.Context, client *ethclient.Client, contractABI abi.ABI, address common.Address, method string, args ...interface{}) ([]interface{}, error) {
+	data, err := contractABI.Pack(method, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := client.CallContract(ctx, ethereum.CallMsg{To: &address, Data: data}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s() call failed: %w", method, err)
+	}
+
+	values, err := contractABI.Unpack(method, output)
+	if err != nil {
+		return nil, fmt.Errorf("%s() returned an unexpected value: %w", method, err)
+	}
+	return values, nil
+}
+
+type TokenMetadata struct {
+	Address  string `json:"address"`
+	Name     string `json:"name"`
+	Symbol   string `json:"symbol"`
+	Decimals uint8  `json:"decimals"`
+}
+
+func fetchTokenMetadata(ctx context.Context, address common.Address) (TokenMetadata, error) {
+	client, err := getRPCClient()
+	if err != nil {
+		return TokenMetadata{}, err
+	}
+
+	code, err := client.CodeAt(ctx, address, nil)
+	if err != nil {
+		return TokenMetadata{}, fmt.Errorf("fetching contract code: %w", err)
+	}
+	if len(code) == 0 {
+		return TokenMetadata{}, fmt.Errorf("no contract deployed at %s", address.Hex())
+	}
+
+	metadata := TokenMetadata{Address: address.Hex()}
+
+	name, err := callContract(ctx, client, erc20ABI, address, "name")
+	if err != nil {
+		return TokenMetadata{}, err
+	}
+	symbol, err := callContract(ctx, client, erc20ABI, address, "symbol")
+	if err != nil {
+		return TokenMetadata{}, err
+	}
+	decimals, err := callContract(ctx, client, erc20ABI, address, "decimals")
+	if err != nil {
+		return TokenMetadata{}, err
+	}
+
+	metadata.Name = name[0].(string)
+	metadata.Symbol = symbol[0].(string)
+	metadata.Decimals = decimals[0].(uint8)
+	return metadata, nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"strconv"
+)
+
+// linearScalingPairs lists "input/output" pairs from LINEAR_SCALING_PAIRS
+// (comma separated) whose price impact is negligible at the amounts clients
+// ask for. They are quoted once at LINEAR_BASE_AMOUNT and scaled linearly to
+// the requested amount, so every amount is served from one cached quote.
+var (
+	linearScalingPairs = parsePairSet(envString("LINEAR_SCALING_PAIRS", ""))
+	linearBaseAmount   = envString("LINEAR_BASE_AMOUNT", UNIT_AMOUNT)
+)
+
+// getScaledQuote quotes the base amount and scales it to amount.
+func getScaledQuote(ctx context.Context, inputToken, outputToken, amount string, fresh bool) (Result, bool, error) {
+	base, cached, err := resolveQuote(ctx, inputToken, outputToken, linearBaseAmount, fresh)
+	if err != nil || amount == linearBaseAmount {
+		return base, cached, err
+	}
+
+	inputAmount, err := strconv.ParseFloat(amount, 64)
+	if err != nil || inputAmount <= 0 {
+		// not an amount we can scale to, quote it as is
+		return resolveQuote(ctx, inputToken, outputToken, amount, fresh)
+	}
+	return scaleResult(base, inputAmount), cached, nil
+}
+
+// scaleResult rescales a quote to a different input amount at the same rate.
+// Amounts are truncated to the output's precision like a scraped quote.
+func scaleResult(base Result, inputAmount float64) Result {
+	if base.Input.Amount == 0 {
+		return base
+	}
+	factor := inputAmount / base.Input.Amount
+
+	rawOutput := base.rawOutputAmount
+	if rawOutput == 0 {
+		rawOutput = base.Output.Amount
+	}
+	decimalPlaces := outputDecimalPlaces(base.Output.Token)
+	if base.Precision != nil {
+		decimalPlaces = base.Precision.Output
+	}
+
+	result := base
+	result.Input.Amount = inputAmount
+	result.rawOutputAmount = rawOutput * factor
+	result.Output.Amount, result.PrecisionExtended = truncateOutput(result.rawOutputAmount, decimalPlaces)
+	result.ExchangeRate = exchangeRate(result.Output.Amount, inputAmount)
+	result.ScaledFrom = base.Input.Amount
+	if base.Fee != nil {
+		fee := *base.Fee
+		fee.Amount *= factor
+		result.Fee = &fee
+	}
+	if base.GrossOutputAmount != 0 {
+		result.GrossOutputAmount *= factor
+	}
+	return result
+}
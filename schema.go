@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// SCHEMA_VERSION is the current shape of Result. Version 1 is the original
+// response with only the pair, exchange rate and timestamp; everything added
+// since belongs to version 2.
+const SCHEMA_VERSION = 2
+
+var schemaV1Fields = map[string]bool{
+	"input":         true,
+	"output":        true,
+	"exchange_rate": true,
+	"timestamp":     true,
+}
+
+// parseSchemaVersion reads an Accept-Version header such as "1" or "v1". An
+// empty header selects the current version.
+func parseSchemaVersion(header string) (int, bool) {
+	header = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(header)), "v")
+	if header == "" {
+		return SCHEMA_VERSION, true
+	}
+	version, err := strconv.Atoi(header)
+	if err != nil || version < 1 || version > SCHEMA_VERSION {
+		return 0, false
+	}
+	return version, true
+}
+
+// shapeResult drops the fields a client pinned to an older version doesn't
+// know about.
+func shapeResult(result Result, version int) (interface{}, error) {
+	if version >= SCHEMA_VERSION {
+		return result, nil
+	}
+
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		return nil, err
+	}
+	for field := range fields {
+		if !schemaV1Fields[field] {
+			delete(fields, field)
+		}
+	}
+	return fields, nil
+}
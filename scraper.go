@@ -0,0 +1,968 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+// swapBaseURL is the swap page, SWAP_BASE_URL, that from and to are added to
+// as query parameters. Pointing it at a staging deployment or a local mock
+// page changes where every scrape goes.
+var swapBaseURL = envString("SWAP_BASE_URL", DEFAULT_SWAP_BASE_URL)
+
+// swapURLTemplates is the prioritized list of swap pages to try, read from the
+// comma-separated SWAP_URL_TEMPLATES and defaulting to swapBaseURL alone.
+// {from} and {to} are replaced with the token addresses.
+var swapURLTemplates []string
+
+func swapURLTemplate(baseURL string) (string, error) {
+	parsed, err := url.Parse(baseURL)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return "", fmt.Errorf("invalid SWAP_BASE_URL %q: want an absolute URL", baseURL)
+	}
+	separator := "?"
+	if strings.Contains(baseURL, "?") {
+		separator = "&"
+	}
+	return baseURL + separator + "from={from}&to={to}", nil
+}
+
+func parseSwapURLTemplates(value, fallback string) []string {
+	var templates []string
+	for _, template := range strings.Split(value, ",") {
+		if template = strings.TrimSpace(template); template != "" {
+			templates = append(templates, template)
+		}
+	}
+	if len(templates) == 0 {
+		return []string{fallback}
+	}
+	return templates
+}
+
+func swapURLs(fromAddress, toAddress string) []string {
+	urls := make([]string, len(swapURLTemplates))
+	for i, template := range swapURLTemplates {
+		urls[i] = strings.NewReplacer("{from}", fromAddress, "{to}", toAddress).Replace(template)
+	}
+	return urls
+}
+
+func mirrorHost(targetURL string) string {
+	parsed, err := url.Parse(targetURL)
+	if err != nil || parsed.Host == "" {
+		return targetURL
+	}
+	return parsed.Host
+}
+
+// detailScript looks for a label in the swap details matching labelPattern
+// (a JavaScript regex) and returns the text rendered next to it, or an empty
+// string when kuru doesn't show one.
+func detailScript(labelPattern string) string {
+	return `(() => {
+	const labels = Array.from(document.querySelectorAll('div, span, p'))
+		.filter(el => el.children.length === 0 && /` + labelPattern + `/i.test(el.textContent.trim()));
+	for (const label of labels) {
+		const value = label.nextElementSibling || label.parentElement?.nextElementSibling;
+		if (value && value.textContent.trim() !== "") {
+			return value.textContent.trim();
+		}
+	}
+	return "";
+})()`
+}
+
+var (
+	feeScript         = detailScript(`^(swap\s+)?fees?:?$`)
+	priceImpactScript = detailScript(`^price\s+impact:?$`)
+)
+
+var percentPattern = regexp.MustCompile(`-?\d+(\.\d+)?`)
+
+// parsePriceImpact reads a displayed price impact such as "0.35%" or
+// "<0.01%" as a percentage. It returns nil when there is none.
+func parsePriceImpact(text string) *float64 {
+	match := percentPattern.FindString(strings.ReplaceAll(text, ",", ""))
+	if match == "" {
+		return nil
+	}
+	impact, err := strconv.ParseFloat(match, 64)
+	if err != nil {
+		return nil
+	}
+	impact = math.Abs(impact)
+	return &impact
+}
+
+func parseFee(text string) *Fee {
+	text = strings.TrimSpace(strings.ReplaceAll(text, ",", ""))
+	if text == "" {
+		return nil
+	}
+
+	if strings.HasSuffix(text, "%") {
+		pct, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(text, "%")), 64)
+		if err != nil || pct < 0 {
+			return nil
+		}
+		return &Fee{Bps: pct * 100}
+	}
+
+	fields := strings.Fields(text)
+	amount, err := strconv.ParseFloat(strings.TrimPrefix(fields[0], "$"), 64)
+	if err != nil || amount < 0 {
+		return nil
+	}
+	fee := &Fee{Amount: amount}
+	if len(fields) > 1 {
+		fee.Token = strings.ToLower(fields[1])
+	} else if strings.HasPrefix(fields[0], "$") {
+		fee.Token = "usd"
+	}
+	return fee
+}
+
+func grossExchangeRate(fee *Fee, inputAmount, outputAmount float64, outputToken string) float64 {
+	if fee == nil || inputAmount == 0 {
+		return 0
+	}
+	if fee.Bps > 0 && fee.Bps < 10000 {
+		return exchangeRate(outputAmount/(1-fee.Bps/10000), inputAmount)
+	}
+	if fee.Amount > 0 && fee.Token == outputToken {
+		return exchangeRate(outputAmount+fee.Amount, inputAmount)
+	}
+	return 0
+}
+
+const DEFAULT_FETCH_TIMEOUT = 30 * time.Second
+
+// After typing the amount the output field is polled every
+// SETTLE_POLL_INTERVAL until it shows the same positive number twice in a
+// row, or kuru reports no route. SETTLE_MAX_WAIT caps the wait for a page
+// that never fills in; whatever is there then gets read as usual.
+var (
+	settlePollInterval = envDuration("SETTLE_POLL_INTERVAL", 250*time.Millisecond)
+	settleMaxWait      = envDuration("SETTLE_MAX_WAIT", 10*time.Second)
+)
+
+// Retries of a failed scrape (a blank page, an unparseable value, a
+// navigation timeout). SCRAPE_MAX_RETRIES is the total number of attempts;
+// the pause before each retry starts at SCRAPE_RETRY_DELAY and doubles, up to
+// SCRAPE_RETRY_MAX_DELAY.
+var (
+	scrapeMaxAttempts   = max(envInt("SCRAPE_MAX_RETRIES", 3), 1)
+	scrapeRetryDelay    = envDuration("SCRAPE_RETRY_DELAY", 2*time.Second)
+	scrapeRetryMaxDelay = envDuration("SCRAPE_RETRY_MAX_DELAY", 15*time.Second)
+)
+
+// retryBackoff is the pause after the given failed attempt.
+func retryBackoff(attempt int) time.Duration {
+	delay := scrapeRetryDelay
+	for i := 1; i < attempt && delay < scrapeRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, scrapeRetryMaxDelay)
+}
+
+// fetchTimeout bounds loading and reading one swap page, FETCH_TIMEOUT.
+var fetchTimeout = envDuration("FETCH_TIMEOUT", DEFAULT_FETCH_TIMEOUT)
+
+// scrapedQuote holds the raw strings read off the swap page before parsing.
+type scrapedQuote struct {
+	inputValue  string
+	outputValue string
+	feeValue    string
+	impactValue string
+	noRoute     bool
+	mirror      string
+}
+
+// The shared headless Chrome every scrape opens its tab in, launched once
+// instead of per request. It is relaunched if opening a tab fails.
+var (
+	browserMutex       sync.Mutex
+	sharedBrowserCtx   context.Context
+	closeSharedBrowser context.CancelFunc
+)
+
+// chromeRemoteURL is the DevTools endpoint of an already running Chrome, e.g.
+// a browserless sidecar at ws://chrome:3000. When it is set no local Chrome is
+// launched.
+var chromeRemoteURL = envString("CHROME_REMOTE_URL", "")
+
+// CHROME_PATH points at the Chrome or Chromium binary to launch instead of the
+// one found on PATH. CHROME_FLAGS adds comma-separated command-line switches,
+// "name=value" or a bare "name", after the defaults, so "no-sandbox=false" can
+// also turn one of those back off.
+var (
+	chromePath  = envString("CHROME_PATH", "")
+	chromeFlags = parseChromeFlags(envString("CHROME_FLAGS", ""))
+)
+
+func parseChromeFlags(value string) []chromedp.ExecAllocatorOption {
+	var flags []chromedp.ExecAllocatorOption
+	for _, flag := range strings.Split(value, ",") {
+		flag = strings.TrimLeft(strings.TrimSpace(flag), "-")
+		if flag == "" {
+			continue
+		}
+		name, flagValue, found := strings.Cut(flag, "=")
+		switch {
+		case !found:
+			flags = append(flags, chromedp.Flag(name, true))
+		case flagValue == "true" || flagValue == "false":
+			flags = append(flags, chromedp.Flag(name, flagValue == "true"))
+		default:
+			flags = append(flags, chromedp.Flag(name, flagValue))
+		}
+	}
+	return flags
+}
+
+func newAllocator() (context.Context, context.CancelFunc) {
+	if chromeRemoteURL != "" {
+		return chromedp.NewRemoteAllocator(context.Background(), chromeRemoteURL)
+	}
+
+	opts := append(chromedp.DefaultExecAllocatorOptions[:],
+		chromedp.Flag("headless", true),
+		chromedp.Flag("disable-gpu", true),
+		chromedp.Flag("no-sandbox", true),
+		chromedp.Flag("disable-dev-shm-usage", true),
+	)
+	if chromePath != "" {
+		opts = append(opts, chromedp.ExecPath(chromePath))
+	}
+	opts = append(opts, chromeFlags...)
+	return chromedp.NewExecAllocator(context.Background(), opts...)
+}
+
+// startBrowser returns the shared browser context, launching Chrome (or
+// connecting to CHROME_REMOTE_URL) if it isn't running yet.
+func startBrowser() (context.Context, error) {
+	browserMutex.Lock()
+	defer browserMutex.Unlock()
+
+	if sharedBrowserCtx != nil && sharedBrowserCtx.Err() == nil {
+		return sharedBrowserCtx, nil
+	}
+
+	allocCtx, cancelAlloc := newAllocator()
+	browserCtx, cancelBrowser := chromedp.NewContext(allocCtx, chromedp.WithLogf(log.Printf))
+	if err := chromedp.Run(browserCtx); err != nil {
+		cancelBrowser()
+		cancelAlloc()
+		if chromeRemoteURL != "" {
+			return nil, fmt.Errorf("connecting to browser at %s: %w", chromeRemoteURL, err)
+		}
+		return nil, fmt.Errorf("launching browser: %w", err)
+	}
+	if chromeRemoteURL != "" {
+		log.Printf("[BROWSER] Connected to remote Chrome at %s", chromeRemoteURL)
+	} else {
+		log.Printf("[BROWSER] Launched shared headless Chrome")
+	}
+
+	sharedBrowserCtx = browserCtx
+	closeSharedBrowser = func() {
+		cancelBrowser()
+		cancelAlloc()
+	}
+	return browserCtx, nil
+}
+
+// stopBrowser shuts the shared Chrome down, closing any open tabs.
+func stopBrowser() {
+	browserMutex.Lock()
+	defer browserMutex.Unlock()
+
+	if closeSharedBrowser != nil {
+		closeSharedBrowser()
+		log.Printf("[BROWSER] Shut down shared headless Chrome")
+	}
+	sharedBrowserCtx, closeSharedBrowser = nil, nil
+}
+
+// restartBrowser drops the shared Chrome if it is still the one browserCtx
+// came from, so the next startBrowser launches a new one.
+func restartBrowser(browserCtx context.Context) {
+	browserMutex.Lock()
+	current := sharedBrowserCtx
+	browserMutex.Unlock()
+
+	if current == browserCtx {
+		log.Printf("[BROWSER] Shared Chrome stopped responding, relaunching")
+		stopBrowser()
+	}
+}
+
+// newTab opens a tab of its own in the shared browser, so concurrent scrapes
+// don't navigate each other's pages. Cancelling it closes only the tab.
+func newTab() (context.Context, context.CancelFunc, error) {
+	var err error
+	for attempt := 1; attempt <= 2; attempt++ {
+		var browserCtx context.Context
+		browserCtx, err = startBrowser()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		tabCtx, cancel := chromedp.NewContext(browserCtx)
+		if err = chromedp.Run(tabCtx); err == nil {
+			return tabCtx, cancel, nil
+		}
+		cancel()
+		restartBrowser(browserCtx)
+	}
+	return nil, nil, fmt.Errorf("opening tab: %w", err)
+}
+
+// openSwapPage navigates the tab to the first mirror that renders the swap
+// form. The returned context carries the per-page scrape timeout.
+func openSwapPage(browserCtx context.Context, selectors Selectors, targetURLs []string) (context.Context, context.CancelFunc, string, error) {
+	if err := chromedp.Run(browserCtx, blockRequests()); err != nil {
+		return nil, nil, "", fmt.Errorf("enabling request blocking: %w", err)
+	}
+
+	var err error
+	for _, targetURL := range targetURLs {
+		ctx, cancel := context.WithTimeout(browserCtx, fetchTimeout)
+		var selector string
+		err = chromedp.Run(ctx,
+			prepareSession(targetURL),
+			timedPhase("navigate", chromedp.Navigate(targetURL)),
+			timedPhase("wait_visible",
+				dismissGate(selectors.Input),
+				waitInputVisible(selectors, &selector),
+				waitFormReady(&selector),
+			),
+		)
+		if err == nil {
+			return context.WithValue(ctx, inputSelectorKey{}, selector), cancel, mirrorHost(targetURL), nil
+		}
+		cancel()
+		if errors.Is(err, errSelectorNotFound) {
+			log.Printf("[SCRAPER BROKEN] %s: %v", mirrorHost(targetURL), err)
+		}
+		log.Printf("[MIRROR] Navigation to %s failed: %v", mirrorHost(targetURL), err)
+		if browserCtx.Err() != nil {
+			break
+		}
+	}
+	return nil, nil, "", err
+}
+
+// errSelectorNotFound means the page loaded but the swap form never showed
+// up, which points at a markup change on kuru rather than a slow upstream.
+var errSelectorNotFound = errors.New("swap input not found, kuru's markup may have changed")
+
+// inputWaitTimeout is how long the input, or its alternate selector, may take
+// to become visible.
+var inputWaitTimeout = envDuration("INPUT_WAIT_TIMEOUT", 15*time.Second)
+
+type inputSelectorKey struct{}
+
+// inputSelector is the selector that matched the amount input on the page
+// ctx was opened for.
+func inputSelector(ctx context.Context, selectors Selectors) string {
+	if selector, ok := ctx.Value(inputSelectorKey{}).(string); ok && selector != "" {
+		return selector
+	}
+	return selectors.Input
+}
+
+const INPUT_VISIBLE_SCRIPT = `((selectors) => {
+	for (const selector of selectors) {
+		const el = document.querySelector(selector);
+		if (el && el.getClientRects().length > 0) return selector;
+	}
+	return "";
+})(%s)`
+
+// waitInputVisible waits for the input selector, or failing that the
+// alternate one, and stores whichever matched.
+func waitInputVisible(configured Selectors, selected *string) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		waitCtx, cancel := context.WithTimeout(ctx, inputWaitTimeout)
+		defer cancel()
+
+		selectors := []string{configured.Input}
+		if configured.AltInput != "" {
+			selectors = append(selectors, configured.AltInput)
+		}
+		quoted, err := json.Marshal(selectors)
+		if err != nil {
+			return err
+		}
+		script := fmt.Sprintf(INPUT_VISIBLE_SCRIPT, quoted)
+
+		for {
+			var found string
+			err := chromedp.Evaluate(script, &found).Do(waitCtx)
+			if err == nil && found != "" {
+				if found != configured.Input {
+					log.Printf("[SCRAPER] Primary input selector missing, using %s", found)
+				}
+				*selected = found
+				return nil
+			}
+			if err != nil && waitCtx.Err() == nil {
+				return fmt.Errorf("looking for swap input: %w", err)
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-waitCtx.Done():
+				return fmt.Errorf("%w: none of %v visible after %v", errSelectorNotFound, selectors, inputWaitTimeout)
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+	})
+}
+
+// formReadyTimeout bounds how long to wait, after the input is visible, for it
+// to also be enabled and focusable. On a cold start the form renders before it
+// is hydrated and keys sent too early are lost.
+var formReadyTimeout = envDuration("FORM_READY_TIMEOUT", 10*time.Second)
+
+const FORM_READY_SCRIPT = `((selector) => {
+	const el = document.querySelector(selector);
+	if (!el || el.disabled || el.readOnly) return false;
+	el.focus();
+	return document.activeElement === el;
+})(%s)`
+
+func waitFormReady(selector *string) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, formReadyTimeout)
+		defer cancel()
+
+		quoted, err := json.Marshal(*selector)
+		if err != nil {
+			return err
+		}
+		script := fmt.Sprintf(FORM_READY_SCRIPT, quoted)
+		for {
+			var ready bool
+			if err := chromedp.Evaluate(script, &ready).Do(ctx); err != nil {
+				return fmt.Errorf("waiting for swap form: %w", err)
+			}
+			if ready {
+				return nil
+			}
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("swap form not interactive after %v: %w", formReadyTimeout, ctx.Err())
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+	})
+}
+
+func settledOutputScript(s Selectors) string {
+	return `(() => {
+	let raw = ` + outputScript(s) + `;
+	if (raw === "0") {
+		try { raw = ` + outputFallbackScript(s) + `; } catch (e) {}
+	}
+	const value = parseFloat(String(raw).replace(/,/g, ""));
+	if (value > 0) return String(value);
+	return ` + NO_ROUTE_SCRIPT + ` ? "no_route" : "";
+})()`
+}
+
+// settledInputScript is settledOutputScript for the input field, which kuru
+// fills in when the output amount is typed.
+func settledInputScript(selector string) string {
+	return `(() => {
+	const raw = document.querySelector(` + jsString(selector) + `)?.value || "";
+	const value = parseFloat(String(raw).replace(/,/g, ""));
+	if (value > 0) return String(value);
+	return ` + NO_ROUTE_SCRIPT + ` ? "no_route" : "";
+})()`
+}
+
+func waitOutputSettled(selectors Selectors) chromedp.Action {
+	return waitSettled(settledOutputScript(selectors))
+}
+
+func waitInputSettled(selector string) chromedp.Action {
+	return waitSettled(settledInputScript(selector))
+}
+
+// waitSettled polls script until it returns the same value twice in a row or
+// reports no route.
+func waitSettled(script string) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		waitCtx, cancel := context.WithTimeout(ctx, settleMaxWait)
+		defer cancel()
+
+		previous := ""
+		for {
+			var current string
+			if err := chromedp.Evaluate(script, &current).Do(waitCtx); err != nil {
+				if ctx.Err() != nil {
+					return err
+				}
+				if waitCtx.Err() != nil {
+					return nil
+				}
+				return fmt.Errorf("waiting for quote: %w", err)
+			}
+			if current == "no_route" || (current != "" && current == previous) {
+				return nil
+			}
+			previous = current
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-waitCtx.Done():
+				log.Printf("[SETTLE] Output still unsettled after %v", settleMaxWait)
+				return nil
+			case <-time.After(settlePollInterval):
+			}
+		}
+	})
+}
+
+// readQuote types the amount into the open swap form and reads back the
+// input, output and fee values once the quote has settled. On SIDE_OUTPUT
+// the amount goes into the output field and the input is read back instead.
+func readQuote(ctx context.Context, selectors Selectors, amount, side string) (scrapedQuote, error) {
+	var quote scrapedQuote
+	selector := inputSelector(ctx, selectors)
+
+	typed, settle := selector, waitOutputSettled(selectors)
+	readOutput := chromedp.Evaluate(outputScript(selectors), &quote.outputValue)
+	if side == SIDE_OUTPUT {
+		typed, settle = selectors.OutputFallback, waitInputSettled(selector)
+		readOutput = chromedp.Value(selectors.OutputFallback, &quote.outputValue, chromedp.ByQuery)
+	}
+
+	err := chromedp.Run(ctx,
+		timedPhase("settle",
+			chromedp.Clear(typed, chromedp.ByQuery),
+			chromedp.SendKeys(typed, amount, chromedp.ByQuery),
+			settle,
+		),
+		timedPhase("extract",
+			chromedp.Value(selector, &quote.inputValue, chromedp.ByQuery),
+			readOutput,
+			chromedp.ActionFunc(func(ctx context.Context) error {
+				if quote.outputValue == "0" || quote.outputValue == "" {
+					var result string
+					err := chromedp.Evaluate(outputFallbackScript(selectors), &result).Do(ctx)
+					if err == nil && result != "" {
+						quote.outputValue = result
+					}
+				}
+				return nil
+			}),
+			chromedp.ActionFunc(func(ctx context.Context) error {
+				if err := chromedp.Evaluate(feeScript, &quote.feeValue).Do(ctx); err != nil {
+					quote.feeValue = ""
+				}
+				if err := chromedp.Evaluate(priceImpactScript, &quote.impactValue).Do(ctx); err != nil {
+					quote.impactValue = ""
+				}
+				if quote.outputValue == "0" || quote.outputValue == "" {
+					if err := chromedp.Evaluate(NO_ROUTE_SCRIPT, &quote.noRoute).Do(ctx); err != nil {
+						quote.noRoute = false
+					}
+				}
+				return nil
+			}),
+		),
+	)
+
+	quote.inputValue = strings.TrimSpace(quote.inputValue)
+	quote.outputValue = strings.TrimSpace(quote.outputValue)
+	return quote, err
+}
+
+// errNoRoute means kuru has no way to swap the pair, as opposed to the scrape
+// failing.
+var errNoRoute = errors.New("no route available for this pair")
+
+// errZeroInput is an input field that reads back as nothing, which would make
+// the rate infinite.
+var errZeroInput = errors.New("swap page shows no input amount to compute a rate from")
+
+// errEmptyOutput is an output field kuru never filled in. A page that stays
+// empty on every attempt is treated as having no route.
+var errEmptyOutput = errors.New("output value is empty")
+
+const NO_ROUTE_SCRIPT = `/no route|no routes found|insufficient liquidity/i.test(document.body.innerText)`
+
+// parseQuote turns the scraped strings into amounts and rejects results that
+// can't be a real conversion.
+func parseQuote(inputToken, outputToken string, quote scrapedQuote) (float64, float64, error) {
+	inputAmount, err := strconv.ParseFloat(quote.inputValue, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("parsing input value: %w", err)
+	}
+	if !(inputAmount > 0) || math.IsInf(inputAmount, 0) {
+		return 0, 0, fmt.Errorf("%w: %q", errZeroInput, quote.inputValue)
+	}
+
+	if quote.noRoute {
+		return 0, 0, errNoRoute
+	}
+	if quote.outputValue == "" {
+		return 0, 0, errEmptyOutput
+	}
+	outputAmount, err := strconv.ParseFloat(quote.outputValue, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("parsing output value: %w", err)
+	}
+
+	if (inputAmount == outputAmount && inputToken != outputToken) || outputAmount == 0 {
+		log.Printf("Invalid result detected. Input: %f, Output: %f", inputAmount, outputAmount)
+		return 0, 0, errInvalidResult
+	}
+	return inputAmount, outputAmount, nil
+}
+
+func buildResult(inputToken, outputToken string, inputAmount, rawOutputAmount float64, quote scrapedQuote) Result {
+	decimalPlaces := resultDecimalPlaces(outputToken, quote.outputValue)
+	outputAmount, precisionExtended := truncateOutput(rawOutputAmount, decimalPlaces)
+
+	fee := parseFee(quote.feeValue)
+	quotedAt := time.Now()
+
+	result := Result{
+		Input: struct {
+			Amount float64 `json:"amount"`
+			Token  string  `json:"token"`
+		}{
+			Amount: inputAmount,
+			Token:  inputToken,
+		},
+		Output: struct {
+			Amount float64 `json:"amount"`
+			Token  string  `json:"token"`
+		}{
+			Amount: outputAmount,
+			Token:  outputToken,
+		},
+		ExchangeRate:      exchangeRate(outputAmount, inputAmount),
+		GrossExchangeRate: grossExchangeRate(fee, inputAmount, outputAmount, outputToken),
+		Fee:               fee,
+		PriceImpact:       parsePriceImpact(quote.impactValue),
+		Mirror:            quote.mirror,
+		PrecisionExtended: precisionExtended,
+		Source:            "live",
+		Precision: &Precision{
+			Input:  inputDecimalPlaces(inputToken, quote.inputValue),
+			Output: decimalPlaces,
+			Rate:   decimalPlaces,
+		},
+		Sequence:        quoteSequence.Add(1),
+		Timestamp:       quotedAt.Format(time.RFC3339),
+		UnixTimestamp:   quotedAt.Unix(),
+		rawOutputAmount: rawOutputAmount,
+		scraped:         quote,
+	}
+	applyTransferFee(&result, decimalPlaces)
+
+	return result
+}
+
+// quoteSequence numbers every quote as it is produced. A quote keeps its
+// number when served again from the cache, so consumers can order quotes and
+// spot duplicates by it.
+var quoteSequence atomic.Uint64
+
+// decimalPlacesMode picks where the output precision comes from: "table" uses
+// outputDecimalPlaces, "scraped" uses however many decimals kuru displayed for
+// the output, falling back to the table when that can't be read.
+var decimalPlacesMode = envString("DECIMAL_PLACES_MODE", "table")
+
+func resultDecimalPlaces(outputToken, scrapedOutput string) int {
+	if decimalPlacesMode == "scraped" {
+		if places, ok := scrapedDecimalPlaces(scrapedOutput); ok {
+			return places
+		}
+	}
+	return outputDecimalPlaces(outputToken)
+}
+
+// inputDecimalPlaces is how many decimals of the typed amount kuru kept,
+// falling back to the output table for the token.
+func inputDecimalPlaces(inputToken, scrapedInput string) int {
+	if places, ok := scrapedDecimalPlaces(scrapedInput); ok {
+		return places
+	}
+	return outputDecimalPlaces(inputToken)
+}
+
+// scrapedDecimalPlaces counts the digits after the decimal point of a
+// displayed amount.
+func scrapedDecimalPlaces(value string) (int, bool) {
+	if value == "" || strings.ContainsAny(value, "eE") {
+		return 0, false
+	}
+	_, fraction, found := strings.Cut(value, ".")
+	if !found {
+		return 0, true
+	}
+	if len(fraction) > MAX_DECIMAL_PLACES {
+		return MAX_DECIMAL_PLACES, true
+	}
+	return len(fraction), true
+}
+
+// tokenDecimals is how many decimal places quotes are reported in per output
+// token. Tokens not listed get DEFAULT_DECIMAL_PLACES.
+var tokenDecimals = map[string]int{
+	"lbtc": 8,
+	"usdc": 2,
+	"usdt": 2,
+	"eth":  5,
+	"wbtc": 8,
+}
+
+const DEFAULT_DECIMAL_PLACES = 2
+
+func outputDecimalPlaces(outputToken string) int {
+	if decimalPlaces, ok := tokenDecimals[outputToken]; ok {
+		return decimalPlaces
+	}
+	return DEFAULT_DECIMAL_PLACES
+}
+
+type AmountLimit struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+// tokenAmountLimits bound the input amount per token: below Min the output
+// floors to nothing, above Max the quote is all slippage. TOKEN_AMOUNT_LIMITS
+// overrides entries as JSON, e.g. {"mon": {"min": 0.01, "max": 1000000}}. A
+// zero bound is not enforced.
+var tokenAmountLimits = map[string]AmountLimit{
+	"mon":  {Min: 0.0001, Max: 100_000_000},
+	"wmon": {Min: 0.0001, Max: 100_000_000},
+	"dak":  {Min: 0.0001, Max: 100_000_000},
+	"usdc": {Min: 0.01, Max: 100_000_000},
+	"usdt": {Min: 0.01, Max: 100_000_000},
+	"eth":  {Min: 0.000001, Max: 100_000},
+	"lbtc": {Min: 0.00000001, Max: 10_000},
+	"wbtc": {Min: 0.00000001, Max: 10_000},
+}
+
+func parseAmountLimits(value string, defaults map[string]AmountLimit) (map[string]AmountLimit, error) {
+	if value == "" {
+		return defaults, nil
+	}
+	var configured map[string]AmountLimit
+	if err := json.Unmarshal([]byte(value), &configured); err != nil {
+		return nil, fmt.Errorf("invalid TOKEN_AMOUNT_LIMITS: %w", err)
+	}
+	for token, limit := range configured {
+		defaults[strings.ToLower(token)] = limit
+	}
+	return defaults, nil
+}
+
+func checkAmountLimits(token string, amount float64) error {
+	limit, ok := tokenAmountLimits[token]
+	if !ok {
+		return nil
+	}
+	if limit.Min > 0 && amount < limit.Min {
+		return fmt.Errorf("amount of %s must be at least %v", token, limit.Min)
+	}
+	if limit.Max > 0 && amount > limit.Max {
+		return fmt.Errorf("amount of %s must be at most %v", token, limit.Max)
+	}
+	return nil
+}
+
+// dustPrecision controls what happens when flooring to the token's decimals
+// would turn a non-zero output into 0: "extend" adds decimals until
+// DUST_SIGNIFICANT_DIGITS significant digits survive, "raw" reports the
+// unrounded scraped value. Either way the result is flagged.
+var (
+	dustPrecision         = DUST_EXTEND
+	dustSignificantDigits = envInt("DUST_SIGNIFICANT_DIGITS", 2)
+)
+
+const (
+	DUST_EXTEND = "extend"
+	DUST_RAW    = "raw"
+)
+
+func parseDustPrecision(value string) (string, error) {
+	switch value {
+	case DUST_EXTEND, DUST_RAW:
+		return value, nil
+	}
+	return "", fmt.Errorf("DUST_PRECISION must be %s or %s, got %q", DUST_EXTEND, DUST_RAW, value)
+}
+
+const MAX_DECIMAL_PLACES = 18
+
+func truncateOutput(amount float64, decimalPlaces int) (float64, bool) {
+	factor := math.Pow10(decimalPlaces)
+	truncated := math.Floor(amount*factor) / factor
+	if truncated != 0 || amount <= 0 {
+		return truncated, false
+	}
+
+	if dustPrecision == DUST_RAW {
+		return amount, true
+	}
+
+	for decimalPlaces < MAX_DECIMAL_PLACES && math.Floor(amount*math.Pow10(decimalPlaces)) == 0 {
+		decimalPlaces++
+	}
+	decimalPlaces = min(decimalPlaces+max(dustSignificantDigits, 1)-1, MAX_DECIMAL_PLACES)
+
+	factor = math.Pow10(decimalPlaces)
+	return math.Floor(amount*factor) / factor, true
+}
+
+func fetchTokenPrice(ctx context.Context, inputToken, outputToken, amount string, targetURLs []string) (Result, error) {
+	priority := priorityFromContext(ctx)
+	return scrapeWithRetries(ctx, inputToken, outputToken, amount, func() (Result, error) {
+		if err := acquireBrowser(ctx, priority); err != nil {
+			return Result{}, err
+		}
+		defer browserPool.Release()
+		return scrapeOnce(ctx, inputToken, outputToken, amount, sideFromContext(ctx), targetURLs)
+	})
+}
+
+// scrapeWithRetries runs scrape up to SCRAPE_MAX_ATTEMPTS times, backing off
+// between attempts, and records the outcome for the metrics and the SLO. A
+// full browser pool fails straight away.
+func scrapeWithRetries(ctx context.Context, inputToken, outputToken, amount string, scrape func() (Result, error)) (Result, error) {
+	logger := loggerFrom(ctx).With("input", inputToken, "output", outputToken, "amount", amount)
+	start := time.Now()
+	var err error
+
+	for attempt := 1; attempt <= scrapeMaxAttempts; attempt++ {
+		logger.Info("scrape attempt", "attempt", attempt, "max_attempts", scrapeMaxAttempts)
+
+		var result Result
+		result, err = scrape()
+		if errors.Is(err, errPoolSaturated) {
+			return Result{}, err
+		}
+		if err == nil {
+			scrapeOutcomes.Record(true)
+			fetchDuration.WithLabelValues("success").Observe(time.Since(start).Seconds())
+			result.attempts = attempt
+			return result, nil
+		}
+
+		if ctx.Err() != nil {
+			// nobody is waiting for this quote anymore, which says nothing about kuru
+			logger.Info("scrape cancelled", "attempt", attempt)
+			return Result{}, ctx.Err()
+		}
+		logger.Warn("scrape attempt failed", "attempt", attempt, "error", err)
+		scrapeErrors.WithLabelValues(scrapeErrorType(err)).Inc()
+		if errors.Is(err, errNoRoute) {
+			// retrying won't make a route appear
+			break
+		}
+		if attempt < scrapeMaxAttempts {
+			delay := retryBackoff(attempt)
+			logger.Info("retrying scrape", "attempt", attempt, "delay", delay.String())
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return Result{}, ctx.Err()
+			}
+		}
+	}
+
+	if errors.Is(err, errEmptyOutput) {
+		err = errNoRoute
+	}
+	if errors.Is(err, errNoRoute) {
+		err = fmt.Errorf("%w from %s to %s", errNoRoute, inputToken, outputToken)
+	}
+	if !errors.Is(err, errNoRoute) {
+		scrapeOutcomes.Record(false)
+	}
+	fetchDuration.WithLabelValues("error").Observe(time.Since(start).Seconds())
+	return Result{}, newScrapeError(err)
+}
+
+// poolAcquireTimeout is how long a scrape waits in the pool queue for a
+// browser slot before the request is answered 503.
+var poolAcquireTimeout = envDuration("POOL_ACQUIRE_TIMEOUT", 20*time.Second)
+
+func acquireBrowser(ctx context.Context, priority Priority) error {
+	acquireCtx, cancel := context.WithTimeout(ctx, poolAcquireTimeout)
+	defer cancel()
+
+	err := browserPool.Acquire(acquireCtx, priority)
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		return fmt.Errorf("%w: no browser slot freed up within %v", errPoolSaturated, poolAcquireTimeout)
+	}
+	return err
+}
+
+// scrapeOnce runs one quote in a fresh tab. The tab lives under the shared
+// browser, so closing it when ctx is cancelled is what aborts chromedp.
+func scrapeOnce(ctx context.Context, inputToken, outputToken, amount, side string, targetURLs []string) (Result, error) {
+	tabCtx, cancel, err := newTab()
+	if err != nil {
+		return Result{}, err
+	}
+	defer cancel()
+	stop := context.AfterFunc(ctx, cancel)
+	defer stop()
+
+	return scrapeInBrowser(tabCtx, inputToken, outputToken, amount, side, targetURLs)
+}
+
+// scrapeInBrowser runs a single quote in an already open tab.
+func scrapeInBrowser(browserCtx context.Context, inputToken, outputToken, amount, side string, targetURLs []string) (Result, error) {
+	selectors := selectorsFor(inputToken, outputToken)
+	ctx, cancelPage, mirror, err := openSwapPage(browserCtx, selectors, targetURLs)
+	if err != nil {
+		captureFailure(browserCtx, inputToken, outputToken, err)
+		return Result{}, err
+	}
+	defer cancelPage()
+
+	return quoteOpenPage(ctx, browserCtx, selectors, inputToken, outputToken, amount, side, mirror)
+}
+
+// quoteOpenPage reads the quote for amount off a swap page already showing
+// the pair.
+func quoteOpenPage(ctx, browserCtx context.Context, selectors Selectors, inputToken, outputToken, amount, side, mirror string) (Result, error) {
+	quote, err := readQuote(ctx, selectors, amount, side)
+	if err != nil {
+		captureFailure(browserCtx, inputToken, outputToken, err)
+		return Result{}, err
+	}
+	quote.mirror = mirror
+
+	inputAmount, outputAmount, err := parseQuote(inputToken, outputToken, quote)
+	if err != nil {
+		captureFailure(browserCtx, inputToken, outputToken, err)
+		return Result{}, err
+	}
+	return buildResult(inputToken, outputToken, inputAmount, outputAmount, quote), nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+//go:embed testdata/swap.html
+var swapFixture []byte
+
+// requireChrome skips tests that drive a real browser when there is none.
+func requireChrome(t *testing.T) {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("skipping browser test in short mode")
+	}
+	if chromeRemoteURL != "" || chromePath != "" {
+		return
+	}
+	for _, name := range []string{"google-chrome", "google-chrome-stable", "chromium", "chromium-browser", "headless-shell"} {
+		if _, err := exec.LookPath(name); err == nil {
+			return
+		}
+	}
+	t.Skip("no Chrome found, set CHROME_PATH or CHROME_REMOTE_URL to run")
+}
+
+func TestFetchTokenPriceAgainstFixture(t *testing.T) {
+	requireChrome(t)
+
+	fixture := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(swapFixture)
+	}))
+	defer fixture.Close()
+
+	previousTemplates := swapURLTemplates
+	template, err := swapURLTemplate(fixture.URL + "/swap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	swapURLTemplates = []string{template}
+	t.Cleanup(func() {
+		swapURLTemplates = previousTemplates
+		stopBrowser()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	result, err := fetchTokenPrice(ctx, "mon", "usdc", "2", swapURLs(MON_ADDRESS, USDC_ADDRESS))
+	if err != nil {
+		t.Fatalf("fetchTokenPrice: %v", err)
+	}
+
+	if result.Input.Amount != 2 || result.Output.Amount != 7 {
+		t.Errorf("quoted %v mon for %v usdc, want 2 for 7", result.Input.Amount, result.Output.Amount)
+	}
+	if result.ExchangeRate != 3.5 {
+		t.Errorf("exchange_rate = %v, want 3.5", result.ExchangeRate)
+	}
+	if result.Fee == nil || result.Fee.Bps != 30 {
+		t.Errorf("fee = %+v, want 30 bps", result.Fee)
+	}
+	if result.PriceImpact == nil || *result.PriceImpact != 0.05 {
+		t.Errorf("price_impact = %v, want 0.05", result.PriceImpact)
+	}
+	if result.Source != "live" {
+		t.Errorf("source = %q, want live", result.Source)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+// With DEBUG_SCREENSHOTS=true a failed scrape saves a full-page screenshot
+// of what Chrome saw to SCREENSHOT_DIR. Only the newest SCREENSHOT_MAX_FILES
+// are kept.
+var (
+	debugScreenshots   = envBool("DEBUG_SCREENSHOTS", false)
+	screenshotDir      = envString("SCREENSHOT_DIR", filepath.Join(os.TempDir(), "kuru-screenshots"))
+	screenshotMaxFiles = envInt("SCREENSHOT_MAX_FILES", 50)
+)
+
+const (
+	SCREENSHOT_PREFIX  = "scrape-"
+	SCREENSHOT_TIMEOUT = 5 * time.Second
+)
+
+// captureFailure screenshots the tab after a failed scrape. It never fails
+// the scrape itself, problems are only logged.
+func captureFailure(tabCtx context.Context, inputToken, outputToken string, scrapeErr error) {
+	if !debugScreenshots || tabCtx.Err() != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(tabCtx, SCREENSHOT_TIMEOUT)
+	defer cancel()
+
+	var image []byte
+	if err := chromedp.Run(ctx, chromedp.FullScreenshot(&image, 90)); err != nil {
+		log.Printf("[SCREENSHOT] Failed to capture: %v", err)
+		return
+	}
+	if err := os.MkdirAll(screenshotDir, 0o755); err != nil {
+		log.Printf("[SCREENSHOT] %v", err)
+		return
+	}
+
+	name := fmt.Sprintf("%s%s-%s-%s.png", SCREENSHOT_PREFIX, time.Now().UTC().Format("20060102T150405.000"), inputToken, outputToken)
+	path := filepath.Join(screenshotDir, name)
+	if err := os.WriteFile(path, image, 0o644); err != nil {
+		log.Printf("[SCREENSHOT] %v", err)
+		return
+	}
+	log.Printf("[SCREENSHOT] Saved %s after: %v", path, scrapeErr)
+	pruneScreenshots()
+}
+
+// pruneScreenshots deletes the oldest screenshots beyond the limit. The
+// timestamped names sort chronologically.
+func pruneScreenshots() {
+	entries, err := os.ReadDir(screenshotDir)
+	if err != nil {
+		return
+	}
+	var names []string
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), SCREENSHOT_PREFIX) && strings.HasSuffix(entry.Name(), ".png") {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	for len(names) > max(screenshotMaxFiles, 1) {
+		os.Remove(filepath.Join(screenshotDir, names[0]))
+		names = names[1:]
+	}
+}
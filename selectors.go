@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	DEFAULT_INPUT_SELECTOR           = `input[data-sentry-element="Input"]`
+	DEFAULT_ALT_INPUT_SELECTOR       = `div[data-sentry-component="SwapInput"] input`
+	DEFAULT_AMOUNT_FIELDS_SELECTOR   = `input[data-sentry-element="Input"]`
+	DEFAULT_OUTPUT_FALLBACK_SELECTOR = `div[data-sentry-component="SwapInput"]:nth-of-type(2) input[data-sentry-element="Input"]`
+)
+
+// Selectors locate the swap form on kuru's page. Input is the amount field
+// typed into and AltInput a second guess at it. AmountFields matches both
+// amount fields, the output being the second one showing the "0.00"
+// placeholder; OutputFallback is read when that comes up empty.
+type Selectors struct {
+	Input          string `json:"input,omitempty"`
+	AltInput       string `json:"alt_input,omitempty"`
+	AmountFields   string `json:"amount_fields,omitempty"`
+	OutputFallback string `json:"output_fallback,omitempty"`
+}
+
+// merge fills in whatever override leaves empty from s.
+func (s Selectors) merge(override Selectors) Selectors {
+	if override.Input != "" {
+		s.Input = override.Input
+	}
+	if override.AltInput != "" {
+		s.AltInput = override.AltInput
+	}
+	if override.AmountFields != "" {
+		s.AmountFields = override.AmountFields
+	}
+	if override.OutputFallback != "" {
+		s.OutputFallback = override.OutputFallback
+	}
+	return s
+}
+
+func (s Selectors) validate() error {
+	var missing []string
+	if s.Input == "" {
+		missing = append(missing, "input")
+	}
+	if s.AmountFields == "" {
+		missing = append(missing, "amount_fields")
+	}
+	if s.OutputFallback == "" {
+		missing = append(missing, "output_fallback")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// SelectorConfig is the layout of SELECTORS_FILE: selectors for every pair,
+// and overrides keyed by "input/output" for pairs whose page differs.
+type SelectorConfig struct {
+	Default Selectors            `json:"default"`
+	Pairs   map[string]Selectors `json:"pairs"`
+}
+
+// The defaults can be patched one at a time with INPUT_SELECTOR,
+// ALT_INPUT_SELECTOR, AMOUNT_FIELDS_SELECTOR and OUTPUT_FALLBACK_SELECTOR, or
+// all at once, per pair too, with a SELECTORS_FILE. Either takes effect on
+// restart without a new build.
+var scrapeSelectors SelectorConfig
+
+func envSelectors() Selectors {
+	return Selectors{
+		Input:          envString("INPUT_SELECTOR", DEFAULT_INPUT_SELECTOR),
+		AltInput:       envString("ALT_INPUT_SELECTOR", DEFAULT_ALT_INPUT_SELECTOR),
+		AmountFields:   envString("AMOUNT_FIELDS_SELECTOR", DEFAULT_AMOUNT_FIELDS_SELECTOR),
+		OutputFallback: envString("OUTPUT_FALLBACK_SELECTOR", DEFAULT_OUTPUT_FALLBACK_SELECTOR),
+	}
+}
+
+func loadSelectorConfig(path string, defaults Selectors) (SelectorConfig, error) {
+	config := SelectorConfig{Default: defaults}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return SelectorConfig{}, fmt.Errorf("reading SELECTORS_FILE: %w", err)
+		}
+		var configured SelectorConfig
+		if err := json.Unmarshal(data, &configured); err != nil {
+			return SelectorConfig{}, fmt.Errorf("invalid SELECTORS_FILE %s: %w", path, err)
+		}
+		config.Default = defaults.merge(configured.Default)
+		config.Pairs = make(map[string]Selectors, len(configured.Pairs))
+		for pair, selectors := range configured.Pairs {
+			if strings.Count(pair, "/") != 1 {
+				return SelectorConfig{}, fmt.Errorf("SELECTORS_FILE pair %q is not input/output", pair)
+			}
+			config.Pairs[strings.ToLower(strings.TrimSpace(pair))] = selectors
+		}
+	}
+
+	if err := config.Default.validate(); err != nil {
+		return SelectorConfig{}, fmt.Errorf("invalid scrape selectors: %w", err)
+	}
+	for pair := range config.Pairs {
+		if err := config.selectorsFor(pair).validate(); err != nil {
+			return SelectorConfig{}, fmt.Errorf("invalid scrape selectors for %s: %w", pair, err)
+		}
+	}
+	return config, nil
+}
+
+func (c SelectorConfig) selectorsFor(pair string) Selectors {
+	return c.Default.merge(c.Pairs[pair])
+}
+
+// selectorsFor is what to look for on the swap page of a pair.
+func selectorsFor(inputToken, outputToken string) Selectors {
+	return scrapeSelectors.selectorsFor(pairKey(inputToken, outputToken))
+}
+
+// jsString quotes a selector for use inside a script.
+func jsString(value string) string {
+	quoted, _ := json.Marshal(value)
+	return string(quoted)
+}
+
+func outputScript(s Selectors) string {
+	return `Array.from(document.querySelectorAll(` + jsString(s.AmountFields) + `)).filter(el => el.placeholder === "0.00")[1]?.value || "0"`
+}
+
+func outputFallbackScript(s Selectors) string {
+	return `document.querySelector(` + jsString(s.OutputFallback) + `).value`
+}
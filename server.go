@@ -0,0 +1,64 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// shutdownTimeout is how long in-flight requests, scrapes included, get to
+// finish after SIGINT or SIGTERM before the server closes them.
+var shutdownTimeout = envDuration("SHUTDOWN_TIMEOUT", 30*time.Second)
+
+// newServer wraps the router in an http.Server tuned from the environment.
+// WRITE_TIMEOUT has to cover a full cache-miss scrape: by default up to three
+// attempts of 30s each plus the retry pauses, and raising SCRAPE_MAX_RETRIES
+// or FETCH_TIMEOUT may need it raised too.
+func newServer(addr string, handler http.Handler) *http.Server {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadTimeout:       envDuration("READ_TIMEOUT", 15*time.Second),
+		ReadHeaderTimeout: envDuration("READ_HEADER_TIMEOUT", 5*time.Second),
+		WriteTimeout:      envDuration("WRITE_TIMEOUT", 120*time.Second),
+		IdleTimeout:       envDuration("IDLE_TIMEOUT", 120*time.Second),
+	}
+
+	keepAlive := envBool("KEEP_ALIVE", true)
+	server.SetKeepAlivesEnabled(keepAlive)
+
+	log.Printf("[SERVER] read_timeout=%v write_timeout=%v idle_timeout=%v keep_alive=%t",
+		server.ReadTimeout, server.WriteTimeout, server.IdleTimeout, keepAlive)
+	return server
+}
+
+// TLS_CERT and TLS_KEY are the PEM certificate and key files to serve HTTPS
+// with, for running without a reverse proxy in front. With neither set the
+// server speaks plain HTTP; setting only one of them fails at startup, as
+// does a pair that doesn't load.
+var tlsCertFile, tlsKeyFile string
+
+func parseTLSFiles(certFile, keyFile string) (string, string, error) {
+	if (certFile == "") != (keyFile == "") {
+		return "", "", errors.New("TLS_CERT and TLS_KEY must be set together")
+	}
+	if certFile != "" {
+		if _, err := tls.LoadX509KeyPair(certFile, keyFile); err != nil {
+			return "", "", fmt.Errorf("invalid TLS_CERT/TLS_KEY: %w", err)
+		}
+	}
+	return certFile, keyFile, nil
+}
+
+// serve runs server until it is shut down, over TLS when configured. Shutdown
+// drains HTTPS connections the same way as plain ones.
+func serve(server *http.Server) error {
+	if tlsCertFile == "" {
+		return server.ListenAndServe()
+	}
+	log.Printf("[SERVER] Serving HTTPS with certificate %s", tlsCertFile)
+	return server.ListenAndServeTLS(tlsCertFile, tlsKeyFile)
+}
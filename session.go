@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+)
+
+// Session state applied to every scrape so a cold headless browser gets past
+// any terms/landing gate the swap page shows first-time visitors:
+//
+//	SCRAPE_COOKIES        name=value pairs separated by ';'
+//	SCRAPE_LOCAL_STORAGE  JSON object of localStorage keys to seed
+//	GATE_DISMISS_SELECTOR element to click (if it shows up) after navigation
+var (
+	scrapeCookies       = parseCookies(envString("SCRAPE_COOKIES", ""))
+	scrapeLocalStorage  map[string]string
+	gateDismissSelector = envString("GATE_DISMISS_SELECTOR", "")
+)
+
+const GATE_DISMISS_WAIT = 5 * time.Second
+
+func parseCookies(value string) map[string]string {
+	cookies := make(map[string]string)
+	for _, pair := range strings.Split(value, ";") {
+		name, cookieValue, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || name == "" {
+			continue
+		}
+		cookies[name] = cookieValue
+	}
+	return cookies
+}
+
+func parseLocalStorage(value string) (map[string]string, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var entries map[string]string
+	if err := json.Unmarshal([]byte(value), &entries); err != nil {
+		return nil, fmt.Errorf("invalid SCRAPE_LOCAL_STORAGE: %w", err)
+	}
+	return entries, nil
+}
+
+// prepareSession seeds cookies and localStorage for targetURL. It has to run
+// before navigation so the page sees the state on its first render.
+func prepareSession(targetURL string) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		for name, value := range scrapeCookies {
+			if err := network.SetCookie(name, value).WithURL(targetURL).Do(ctx); err != nil {
+				return fmt.Errorf("setting cookie %s: %w", name, err)
+			}
+		}
+
+		if len(scrapeLocalStorage) > 0 {
+			entries, err := json.Marshal(scrapeLocalStorage)
+			if err != nil {
+				return err
+			}
+			script := fmt.Sprintf(`(() => {
+				const entries = %s;
+				for (const [key, value] of Object.entries(entries)) {
+					localStorage.setItem(key, value);
+				}
+			})()`, entries)
+			if _, err := page.AddScriptToEvaluateOnNewDocument(script).Do(ctx); err != nil {
+				return fmt.Errorf("seeding localStorage: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// dismissGate clicks GATE_DISMISS_SELECTOR if it appears shortly after load.
+// A missing gate is not an error.
+func dismissGate(inputSelector string) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		if gateDismissSelector == "" {
+			return nil
+		}
+
+		gate, err := json.Marshal(gateDismissSelector)
+		if err != nil {
+			return err
+		}
+		form, err := json.Marshal(inputSelector)
+		if err != nil {
+			return err
+		}
+		script := fmt.Sprintf(`(() => {
+			const gate = document.querySelector(%s);
+			if (gate) { gate.click(); return "clicked"; }
+			return document.querySelector(%s) ? "ready" : "";
+		})()`, gate, form)
+
+		// stop as soon as either the gate was clicked or the swap form is
+		// already there without one
+		deadline := time.Now().Add(GATE_DISMISS_WAIT)
+		for time.Now().Before(deadline) {
+			var state string
+			if err := chromedp.Evaluate(script, &state).Do(ctx); err != nil {
+				return err
+			}
+			if state == "clicked" {
+				log.Printf("[GATE] Dismissed landing gate %s", gateDismissSelector)
+				return nil
+			}
+			if state == "ready" {
+				return nil
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(250 * time.Millisecond):
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// The side of the swap form the amount is typed into. With SIDE_OUTPUT the
+// amount is what should come out and kuru works out the input required.
+const (
+	SIDE_INPUT  = "input"
+	SIDE_OUTPUT = "output"
+)
+
+type sideKey struct{}
+
+// withSide attaches the side a quote is for to ctx, for the scraper to read.
+func withSide(ctx context.Context, side string) context.Context {
+	return context.WithValue(ctx, sideKey{}, side)
+}
+
+func sideFromContext(ctx context.Context) string {
+	if side, ok := ctx.Value(sideKey{}).(string); ok {
+		return side
+	}
+	return SIDE_INPUT
+}
+
+// getExactOutputQuote quotes the input needed to receive amount of the
+// output token. The cache is keyed by input amount, so these are always
+// scraped, concurrent requests for the same output sharing one scrape.
+func getExactOutputQuote(ctx context.Context, inputToken, outputToken, amount string) (Result, error) {
+	if maintenanceMode.Load() {
+		return Result{}, errMaintenance
+	}
+
+	flightKey := cacheKey(inputToken, outputToken, amount) + "|" + SIDE_OUTPUT
+	flightCtx, leave := joinFlight(ctx, flightKey)
+	defer leave()
+	flight := scrapeGroup.DoChan(flightKey, func() (result interface{}, err error) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				err = fmt.Errorf("scrape panicked: %v", recovered)
+			}
+		}()
+
+		fetched, err := priceSource.Fetch(withSide(flightCtx, SIDE_OUTPUT), inputToken, outputToken, amount)
+		if err != nil {
+			return nil, err
+		}
+		if isInvalidResult(fetched) {
+			return nil, errInvalidResult
+		}
+		fetched.Side = SIDE_OUTPUT
+		return fetched, nil
+	})
+
+	var outcome singleflight.Result
+	select {
+	case outcome = <-flight:
+	case <-ctx.Done():
+		return Result{}, ctx.Err()
+	}
+	if outcome.Err != nil {
+		return Result{}, outcome.Err
+	}
+	if outcome.Shared {
+		log.Printf("[SINGLEFLIGHT] Shared one scrape of %s", flightKey)
+	}
+	return outcome.Val.(Result), nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// signingKey is loaded from SIGNING_KEY (hex, with or without 0x). When it is
+// set every served quote carries an EIP-191 signature over signingPayload so
+// consumers can ecrecover the signer and verify the quote came from this feed.
+var signingKey *ecdsa.PrivateKey
+
+func loadSigningKey(hexKey string) (*ecdsa.PrivateKey, error) {
+	if hexKey == "" {
+		return nil, nil
+	}
+	key, err := crypto.HexToECDSA(strings.TrimPrefix(hexKey, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SIGNING_KEY: %w", err)
+	}
+	log.Printf("[SIGNING] Quotes will be signed by %s", crypto.PubkeyToAddress(key.PublicKey).Hex())
+	return key, nil
+}
+
+// signingPayload is the canonical serialization that gets signed:
+// input_token|input_amount|output_token|output_amount|exchange_rate|timestamp
+func signingPayload(result Result) string {
+	return strings.Join([]string{
+		result.Input.Token,
+		strconv.FormatFloat(result.Input.Amount, 'f', -1, 64),
+		result.Output.Token,
+		strconv.FormatFloat(result.Output.Amount, 'f', -1, 64),
+		strconv.FormatFloat(result.ExchangeRate, 'f', -1, 64),
+		result.Timestamp,
+	}, "|")
+}
+
+func signResult(result Result) Result {
+	if signingKey == nil {
+		return result
+	}
+
+	payload := signingPayload(result)
+	signature, err := crypto.Sign(accounts.TextHash([]byte(payload)), signingKey)
+	if err != nil {
+		log.Printf("[SIGNING] Failed to sign quote: %v", err)
+		return result
+	}
+	// shift the recovery id to 27/28 as expected by ecrecover
+	signature[crypto.RecoveryIDOffset] += 27
+
+	result.Signature = &Signature{
+		Payload:   payload,
+		Signature: hexutil.Encode(signature),
+		Signer:    crypto.PubkeyToAddress(signingKey.PublicKey).Hex(),
+	}
+	return result
+}
@@ -0,0 +1,36 @@
+package main
+
+import "log"
+
+// midPriceAmount is the input amount small enough that its quote is treated
+// as the mid price, i.e. free of price impact.
+var midPriceAmount = envString("MID_PRICE_AMOUNT", "0.01")
+
+func unroundedRate(result Result) float64 {
+	if result.Input.Amount == 0 {
+		return 0
+	}
+	if result.rawOutputAmount != 0 {
+		return result.rawOutputAmount / result.Input.Amount
+	}
+	return result.ExchangeRate
+}
+
+// effectiveSlippageBps compares the quote's rate with the rate of a
+// near-zero-amount quote for the same pair, in basis points. Positive values
+// mean the requested amount gets a worse rate than the mid price.
+func effectiveSlippageBps(result Result) *float64 {
+	inputToken, outputToken := result.Input.Token, result.Output.Token
+	midResult, _, err := getQuote(inputToken, outputToken, midPriceAmount)
+	if err != nil {
+		log.Printf("[SLIPPAGE] Failed to fetch mid price for %s to %s: %v", inputToken, outputToken, err)
+		return nil
+	}
+
+	midRate := unroundedRate(midResult)
+	if midRate == 0 {
+		return nil
+	}
+	slippage := (midRate - unroundedRate(result)) / midRate * 10000
+	return &slippage
+}
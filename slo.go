@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	sloWindow = envDuration("SLO_WINDOW", time.Hour)
+	sloTarget = envFloat("SLO_TARGET", 0.99)
+)
+
+type outcomeBucket struct {
+	successes int64
+	failures  int64
+}
+
+// ScrapeOutcomes counts scrape successes and failures in one-minute buckets so
+// a rolling success rate can be computed over any window up to SLO_WINDOW.
+type ScrapeOutcomes struct {
+	mutex   sync.Mutex
+	buckets map[int64]*outcomeBucket
+}
+
+func NewScrapeOutcomes() *ScrapeOutcomes {
+	return &ScrapeOutcomes{
+		buckets: make(map[int64]*outcomeBucket),
+	}
+}
+
+func (o *ScrapeOutcomes) Record(success bool) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	minute := time.Now().Unix() / 60
+	bucket, ok := o.buckets[minute]
+	if !ok {
+		bucket = &outcomeBucket{}
+		o.buckets[minute] = bucket
+		o.pruneLocked(minute)
+	}
+	if success {
+		bucket.successes++
+	} else {
+		bucket.failures++
+	}
+}
+
+func (o *ScrapeOutcomes) pruneLocked(currentMinute int64) {
+	oldest := currentMinute - int64(sloWindow/time.Minute)
+	for minute := range o.buckets {
+		if minute < oldest {
+			delete(o.buckets, minute)
+		}
+	}
+}
+
+func (o *ScrapeOutcomes) Totals(window time.Duration) (successes, failures int64) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	oldest := (time.Now().Unix() - int64(window/time.Second)) / 60
+	for minute, bucket := range o.buckets {
+		if minute >= oldest {
+			successes += bucket.successes
+			failures += bucket.failures
+		}
+	}
+	return successes, failures
+}
+
+var scrapeOutcomes = NewScrapeOutcomes()
+
+func handleSLO(c *gin.Context) {
+	successes, failures := scrapeOutcomes.Totals(sloWindow)
+	total := successes + failures
+
+	successRate := 1.0
+	if total > 0 {
+		successRate = float64(successes) / float64(total)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"window":        sloWindow.String(),
+		"target":        sloTarget,
+		"total":         total,
+		"successes":     successes,
+		"failures":      failures,
+		"success_rate":  successRate,
+		"within_target": successRate >= sloTarget,
+	})
+}
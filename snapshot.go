@@ -0,0 +1,133 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CacheSnapshotEntry struct {
+	Input     string    `json:"input"`
+	Output    string    `json:"output"`
+	Amount    string    `json:"amount"`
+	Result    Result    `json:"result"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (c *TokenPairCache) Export() []CacheSnapshotEntry {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	var entries []CacheSnapshotEntry
+	for inputToken, outputs := range c.cache {
+		for outputToken, amounts := range outputs {
+			for amount, entry := range amounts {
+				entries = append(entries, CacheSnapshotEntry{
+					Input:     inputToken,
+					Output:    outputToken,
+					Amount:    amount,
+					Result:    entry.Result,
+					ExpiresAt: entry.ExpiresAt,
+				})
+			}
+		}
+	}
+	return entries
+}
+
+// Import loads snapshot entries keeping their original expiry. Entries that
+// have already expired are dropped. It returns how many were imported.
+func (c *TokenPairCache) Import(entries []CacheSnapshotEntry) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	imported := 0
+	for _, entry := range entries {
+		if !entry.ExpiresAt.After(now) {
+			continue
+		}
+		if _, ok := tokenAddresses[entry.Input]; !ok {
+			continue
+		}
+		if _, ok := tokenAddresses[entry.Output]; !ok {
+			continue
+		}
+
+		if _, ok := c.cache[entry.Input]; !ok {
+			c.cache[entry.Input] = make(map[string]map[string]CacheEntry)
+		}
+		if _, ok := c.cache[entry.Input][entry.Output]; !ok {
+			c.cache[entry.Input][entry.Output] = make(map[string]CacheEntry)
+		}
+		c.cache[entry.Input][entry.Output][entry.Amount] = CacheEntry{
+			Result:    entry.Result,
+			CreatedAt: quoteTime(entry.Result),
+			ExpiresAt: entry.ExpiresAt,
+		}
+		c.recency.touch(entryKey{entry.Input, entry.Output, entry.Amount})
+		imported++
+	}
+	c.evictOverflowLocked()
+	return imported
+}
+
+func handleCacheExport(c *gin.Context) {
+	filename := "cache-" + time.Now().UTC().Format("20060102T150405Z") + ".json"
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.JSON(http.StatusOK, cache.Export())
+}
+
+func handleCacheImport(c *gin.Context) {
+	var entries []CacheSnapshotEntry
+	if err := c.ShouldBindJSON(&entries); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cache snapshot: " + err.Error()})
+		return
+	}
+
+	imported := cache.Import(entries)
+	c.JSON(http.StatusOK, gin.H{
+		"imported": imported,
+		"skipped":  len(entries) - imported,
+	})
+}
+
+// handleCacheEvict drops the entries involving ?token=, or the whole cache
+// when no token is given.
+func handleCacheEvict(c *gin.Context) {
+	token := normalizeToken(c.Query("token"))
+	if token == "" {
+		removed := cache.Flush() + rateCache.Flush()
+		log.Printf("[CACHE] Flushed %d entries", removed)
+		c.JSON(http.StatusOK, gin.H{"removed": removed})
+		return
+	}
+
+	removed := cache.EvictToken(token) + rateCache.EvictToken(token)
+	log.Printf("[CACHE] Evicted %d entries involving %s", removed, token)
+	c.JSON(http.StatusOK, gin.H{
+		"token":   token,
+		"removed": removed,
+	})
+}
+
+func handleCacheStats(c *gin.Context) {
+	hits, misses := cache.Counters()
+	hitRatio := 0.0
+	if hits+misses > 0 {
+		hitRatio = float64(hits) / float64(hits+misses)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"entries":      cache.Len(),
+		"rate_entries": rateCache.Len(),
+		"max_entries":  cacheMaxEntries,
+		"evictions":    cache.Evictions(),
+		"expired":      cache.Expired(),
+		"hits":         hits,
+		"misses":       misses,
+		"hit_ratio":    hitRatio,
+		"ttl_seconds":  cacheTTL.Seconds(),
+	})
+}
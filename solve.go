@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	SOLVE_DEFAULT_TOLERANCE_BPS = 50
+	SOLVE_AMOUNT_DECIMALS       = 6
+)
+
+// solveMaxProbes bounds how many quotes /solve takes, including the unit
+// quote used for the first guess.
+var solveMaxProbes = envInt("SOLVE_MAX_PROBES", 6)
+
+func formatSolveAmount(amount float64) string {
+	formatted := strconv.FormatFloat(amount, 'f', SOLVE_AMOUNT_DECIMALS, 64)
+	return strings.TrimSuffix(strings.TrimRight(formatted, "0"), ".")
+}
+
+// solveInput searches for the input amount whose quote lands within
+// toleranceBps of targetOutput. The first guess comes from the unit rate and
+// every following one rescales the last amount by how far its output missed,
+// which absorbs price impact within a couple of probes. Probes go through the
+// cache like any other quote. It returns the closest quote found and whether
+// it is within tolerance. ctx is the request's, so a client that goes away
+// stops the probing.
+func solveInput(ctx context.Context, inputToken, outputToken string, targetOutput, toleranceBps float64) (Result, string, int, bool, error) {
+	unitResult, _, err := resolveQuote(ctx, inputToken, outputToken, UNIT_AMOUNT, false)
+	if err != nil {
+		return Result{}, "", 1, false, err
+	}
+	if unitResult.ExchangeRate <= 0 {
+		return Result{}, "", 1, false, errInvalidResult
+	}
+
+	var best Result
+	var bestAmount string
+	bestMiss := math.Inf(1)
+	guess := targetOutput / unitResult.ExchangeRate
+	probes := 1
+	for probes < max(solveMaxProbes, 2) {
+		amount := formatSolveAmount(guess)
+		if amount == "0" {
+			return Result{}, "", probes, false, errors.New("target output is too small to quote")
+		}
+		// a guess is held to the same limits as a requested amount
+		err := validateAmount(inputToken, amount)
+		if err == nil {
+			amount, err = fitAmountLength(amount)
+		}
+		if err != nil {
+			if bestAmount != "" {
+				break
+			}
+			return Result{}, "", probes, false, &QuoteError{Code: CODE_INVALID_AMOUNT, Err: fmt.Errorf("target output needs an input that can't be quoted: %w", err)}
+		}
+
+		result, _, err := resolveQuote(ctx, inputToken, outputToken, amount, false)
+		probes++
+		if err != nil {
+			if bestAmount != "" {
+				break
+			}
+			return Result{}, "", probes, false, err
+		}
+
+		miss := math.Abs(result.Output.Amount-targetOutput) / targetOutput * 10000
+		if miss < bestMiss {
+			best, bestAmount, bestMiss = result, amount, miss
+		}
+		if miss <= toleranceBps {
+			return result, amount, probes, true, nil
+		}
+		if result.Output.Amount <= 0 {
+			break
+		}
+		guess *= targetOutput / result.Output.Amount
+	}
+
+	return best, bestAmount, probes, false, nil
+}
+
+func handleSolve(c *gin.Context) {
+	inputToken := normalizeToken(c.Query("input"))
+	outputToken := normalizeToken(c.Query("output"))
+	if inputToken == "" || outputToken == "" || c.Query("target_output") == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "input, output, and target_output parameters are required"})
+		return
+	}
+	if _, exists := tokenAddresses[inputToken]; !exists {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported input token: " + inputToken})
+		return
+	}
+	if _, exists := tokenAddresses[outputToken]; !exists {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported output token: " + outputToken})
+		return
+	}
+	if sameToken(inputToken, outputToken) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errSameToken.Error()})
+		return
+	}
+
+	targetOutput, err := strconv.ParseFloat(c.Query("target_output"), 64)
+	if err != nil || targetOutput <= 0 || math.IsInf(targetOutput, 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "target_output must be a positive number"})
+		return
+	}
+
+	toleranceBps := float64(SOLVE_DEFAULT_TOLERANCE_BPS)
+	if value := c.Query("tolerance_bps"); value != "" {
+		toleranceBps, err = strconv.ParseFloat(value, 64)
+		if err != nil || toleranceBps <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "tolerance_bps must be a positive number"})
+			return
+		}
+	}
+
+	result, requiredInput, probes, converged, err := solveInput(c.Request.Context(), inputToken, outputToken, targetOutput, toleranceBps)
+	if err != nil {
+		code := errorCode(err)
+		respondError(c, errorStatus(code), code, err.Error())
+		return
+	}
+
+	auditQuote(c, result)
+	c.JSON(http.StatusOK, gin.H{
+		"input":          inputToken,
+		"output":         outputToken,
+		"target_output":  targetOutput,
+		"required_input": requiredInput,
+		"tolerance_bps":  toleranceBps,
+		"converged":      converged,
+		"probes":         probes,
+		"quote":          result,
+	})
+}
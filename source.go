@@ -0,0 +1,48 @@
+package main
+
+import "context"
+
+// PriceSource produces a live quote for an amount of a pair. handleTokenPrice
+// and the other quote routes only go through priceSource, so backends other
+// than kuru (or a fake in tests) can be swapped in.
+type PriceSource interface {
+	Fetch(ctx context.Context, inputToken, outputToken, amount string) (Result, error)
+}
+
+// MultiOutputSource is a PriceSource that can quote one input against several
+// outputs more cheaply than one Fetch per output.
+type MultiOutputSource interface {
+	PriceSource
+	FetchOutputs(ctx context.Context, inputToken string, outputTokens []string, amount string) ([]Result, []error)
+}
+
+// priceSource is the backend quotes are fetched from, set up in main.
+var priceSource PriceSource
+
+// KuruSource scrapes the kuru swap page in the shared headless Chrome.
+type KuruSource struct{}
+
+func (KuruSource) Fetch(ctx context.Context, inputToken, outputToken, amount string) (Result, error) {
+	if err := kuruBreaker.Allow(); err != nil {
+		return Result{}, err
+	}
+	targetURLs := swapURLs(tokenAddresses[inputToken], tokenAddresses[outputToken])
+	result, err := fetchTokenPrice(ctx, inputToken, outputToken, amount, targetURLs)
+	kuruBreaker.Record(err)
+	return result, err
+}
+
+type priorityKey struct{}
+
+// withPriority attaches the scheduling priority of a request to ctx, for the
+// browser pool to read.
+func withPriority(ctx context.Context, priority Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, priority)
+}
+
+func priorityFromContext(ctx context.Context) Priority {
+	if priority, ok := ctx.Value(priorityKey{}).(Priority); ok {
+		return priority
+	}
+	return PriorityNormal
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// Spot mode (?mode=spot) quotes a small amount of the input token so the rate
+// is close to the mid price, with little slippage or price impact in it. The
+// amount is SPOT_AMOUNTS[token] when configured, a JSON object of token to
+// amount, and otherwise SPOT_MIN_MULTIPLE times the token's minimum quotable
+// amount. When the output still floors to nothing at the token's decimals the
+// amount is raised tenfold, up to SPOT_MAX_STEPS times.
+var (
+	spotAmounts     map[string]float64
+	spotMinMultiple = envFloat("SPOT_MIN_MULTIPLE", 100)
+	spotMaxSteps    = envInt("SPOT_MAX_STEPS", 3)
+)
+
+// SPOT_DEFAULT_AMOUNT is used for tokens without an amount limit.
+const SPOT_DEFAULT_AMOUNT = 0.01
+
+func parseSpotAmounts(value string) (map[string]float64, error) {
+	amounts := make(map[string]float64)
+	if value == "" {
+		return amounts, nil
+	}
+	if err := json.Unmarshal([]byte(value), &amounts); err != nil {
+		return nil, fmt.Errorf("invalid SPOT_AMOUNTS: %w", err)
+	}
+	for token, amount := range amounts {
+		if amount <= 0 {
+			return nil, fmt.Errorf("invalid SPOT_AMOUNTS: amount of %s must be positive", token)
+		}
+		delete(amounts, token)
+		amounts[strings.ToLower(token)] = amount
+	}
+	return amounts, nil
+}
+
+// spotAmount is the amount of inputToken a spot quote starts from.
+func spotAmount(inputToken string) string {
+	amount, ok := spotAmounts[inputToken]
+	if !ok {
+		amount = SPOT_DEFAULT_AMOUNT
+		if limit, ok := tokenAmountLimits[inputToken]; ok && limit.Min > 0 {
+			amount = limit.Min * spotMinMultiple
+		}
+	}
+	return formatSpotAmount(amount)
+}
+
+// formatSpotAmount writes amount as a plain decimal, rounded to 12
+// significant digits so float error like 0.010000000000000002 drops out.
+func formatSpotAmount(amount float64) string {
+	rounded, _ := strconv.ParseFloat(strconv.FormatFloat(amount, 'g', 12, 64), 64)
+	return canonicalAmount(strconv.FormatFloat(rounded, 'f', -1, 64))
+}
+
+// flooredAway reports an output too small to survive the token's decimals,
+// which would make the rate zero or mostly rounding.
+func flooredAway(result Result) bool {
+	return result.Output.Amount == 0 || result.PrecisionExtended
+}
+
+// getSpotQuote quotes amount, raising it until the output is representable.
+func getSpotQuote(ctx context.Context, inputToken, outputToken, amount string, fresh bool) (Result, bool, error) {
+	result, cached, err := resolveQuote(ctx, inputToken, outputToken, amount, fresh)
+	for step := 1; step <= spotMaxSteps && err == nil && flooredAway(result); step++ {
+		size, parseErr := strconv.ParseFloat(amount, 64)
+		if parseErr != nil || checkAmountLimits(inputToken, size*10) != nil {
+			break
+		}
+		amount = formatSpotAmount(size * 10)
+		log.Printf("[SPOT] Output of %s to %s floors to zero, retrying with amount %s (step %d of %d)",
+			inputToken, outputToken, amount, step, spotMaxSteps)
+		result, cached, err = resolveQuote(ctx, inputToken, outputToken, amount, fresh)
+	}
+	return result, cached, err
+}
+
+// spotPrice is the rate of a spot quote, taken from the unrounded output
+// where that is known so the token's decimals don't skew it.
+func spotPrice(result Result) float64 {
+	if result.Input.Amount == 0 {
+		return 0
+	}
+	if result.rawOutputAmount > 0 {
+		return result.rawOutputAmount / result.Input.Amount
+	}
+	return result.ExchangeRate
+}
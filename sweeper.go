@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"log"
+	"slices"
+	"time"
+)
+
+var cacheSweepInterval = envDuration("CACHE_SWEEP_INTERVAL", 5*time.Minute)
+
+// Sweep deletes entries that expired more than retain ago, pruning maps left
+// empty, and returns how many were removed.
+func (c *TokenPairCache) Sweep(retain time.Duration) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	cutoff := time.Now().Add(-retain)
+	removed := 0
+	for inputToken, outputs := range c.cache {
+		for outputToken, amounts := range outputs {
+			for amount, entry := range amounts {
+				if entry.ExpiresAt.Before(cutoff) {
+					delete(amounts, amount)
+					c.recency.forget(entryKey{inputToken, outputToken, amount})
+					c.keyHits.Delete(entryKey{inputToken, outputToken, amount})
+					removed++
+				}
+			}
+			if len(amounts) == 0 {
+				delete(outputs, outputToken)
+			}
+		}
+		if len(outputs) == 0 {
+			delete(c.cache, inputToken)
+		}
+	}
+	return removed
+}
+
+// cacheRetention is how long expired entries must be kept around. The
+// stale_cache fallback serves them up to STALE_MAX_AGE past expiry and
+// stale-while-revalidate up to STALE_WHILE_REVALIDATE.
+func cacheRetention() time.Duration {
+	retain := max(staleWhileRevalidate, 0)
+	if slices.Contains(fallbackChain, "stale_cache") {
+		retain = max(retain, staleMaxAge)
+	}
+	return retain
+}
+
+func runCacheSweeper(ctx context.Context) {
+	if cacheSweepInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(cacheSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if removed := cache.Sweep(cacheRetention()) + rateCache.Sweep(cacheRetention()); removed > 0 {
+				log.Printf("[CACHE] Swept %d expired entries", removed)
+			}
+			if removed := throttle.Sweep(); removed > 0 {
+				log.Printf("[THROTTLE] Swept %d expired scrapes", removed)
+			}
+			if removed := negativeCache.Sweep(); removed > 0 {
+				log.Printf("[FALLBACK] Swept %d expired negative cache entries", removed)
+			}
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// staleWhileRevalidate is how long past expiry a cache entry is still served
+// straight away, flagged stale, while a refresh runs in the background. Past
+// that hard expiry the request waits for a scrape as usual. Zero, the
+// default, turns it off.
+var staleWhileRevalidate = envDuration("STALE_WHILE_REVALIDATE", 0)
+
+// serveStale reports the expired entry for the amount when it is within the
+// stale-while-revalidate window, and starts refreshing it. skip is set for
+// requests that must not be answered from stale data.
+func serveStale(inputToken, outputToken, amount string, skip bool) (Result, bool) {
+	if staleWhileRevalidate <= 0 || skip {
+		return Result{}, false
+	}
+
+	key := cacheKeyAmount(amount)
+	entry, found := cache.GetEntry(inputToken, outputToken, key)
+	if !found || time.Now().Before(entry.ExpiresAt) || isInvalidResult(entry.Result) {
+		return Result{}, false
+	}
+	if time.Since(entry.ExpiresAt) > staleWhileRevalidate {
+		return Result{}, false
+	}
+
+	go func() {
+		// concurrent refreshes of the key share one scrape through scrapeGroup
+		if _, _, err := resolveQuote(withPriority(context.Background(), PriorityLow), inputToken, outputToken, amount, true); err != nil {
+			log.Printf("[SWR] Background refresh of %s failed: %v", cacheKey(inputToken, outputToken, amount), err)
+		}
+	}()
+
+	result := entry.served()
+	result.Source = "stale_cache"
+	result.Stale = true
+	return result, true
+}
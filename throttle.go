@@ -0,0 +1,80 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// minScrapeInterval is the floor on how often the same pair and amount is
+// scraped. Within the window the result of the last scrape is served instead,
+// even when the caller would otherwise force a live fetch. Zero disables it.
+var minScrapeInterval = envDuration("MIN_SCRAPE_INTERVAL", 0)
+
+type recentScrape struct {
+	result    Result
+	scrapedAt time.Time
+}
+
+type ScrapeThrottle struct {
+	mutex   sync.Mutex
+	scrapes map[string]recentScrape
+}
+
+func NewScrapeThrottle() *ScrapeThrottle {
+	return &ScrapeThrottle{
+		scrapes: make(map[string]recentScrape),
+	}
+}
+
+func (t *ScrapeThrottle) Recent(inputToken, outputToken, amount string) (Result, bool) {
+	if minScrapeInterval <= 0 {
+		return Result{}, false
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	key := pairKey(inputToken, outputToken) + "/" + amount
+	scrape, ok := t.scrapes[key]
+	if !ok {
+		return Result{}, false
+	}
+	if time.Since(scrape.scrapedAt) >= minScrapeInterval {
+		delete(t.scrapes, key)
+		return Result{}, false
+	}
+	return scrape.result, true
+}
+
+func (t *ScrapeThrottle) Record(inputToken, outputToken, amount string, result Result) {
+	if minScrapeInterval <= 0 {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.scrapes[pairKey(inputToken, outputToken)+"/"+amount] = recentScrape{
+		result:    result,
+		scrapedAt: time.Now(),
+	}
+}
+
+// Sweep drops the scrapes older than MIN_SCRAPE_INTERVAL, which Recent would
+// no longer serve, and returns how many were removed. Without it pairs that
+// are scraped once and never asked for again would stay forever.
+func (t *ScrapeThrottle) Sweep() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	removed := 0
+	for key, scrape := range t.scrapes {
+		if time.Since(scrape.scrapedAt) >= minScrapeInterval {
+			delete(t.scrapes, key)
+			removed++
+		}
+	}
+	return removed
+}
+
+var throttle = NewScrapeThrottle()
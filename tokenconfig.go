@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// TokenConfig is one entry of TOKENS_FILE. Decimals is the number of decimal
+// places quotes are reported in; ChainDecimals, the token's on-chain
+// decimals, may only be left out for a built-in token. The amount bounds are
+// optional.
+type TokenConfig struct {
+	Symbol        string  `json:"symbol"`
+	Address       string  `json:"address"`
+	Decimals      *int    `json:"decimals"`
+	ChainDecimals *int    `json:"chain_decimals,omitempty"`
+	MinAmount     float64 `json:"min_amount,omitempty"`
+	MaxAmount     float64 `json:"max_amount,omitempty"`
+}
+
+type TokenList []TokenConfig
+
+// configuredTokens are added to the built-in tokens, replacing any built-in
+// with the same symbol, so tokens kuru lists can be supported with a
+// TOKENS_FILE instead of a new build.
+var configuredTokens TokenList
+
+func loadTokensFile(path string) (TokenList, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading TOKENS_FILE: %w", err)
+	}
+	tokens, err := parseTokenList(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TOKENS_FILE %s: %w", path, err)
+	}
+	return tokens, nil
+}
+
+func parseTokenList(data []byte) (TokenList, error) {
+	var tokens TokenList
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, err
+	}
+
+	builtin := builtinChainDecimals()
+	seen := make(map[string]bool, len(tokens))
+	for i := range tokens {
+		token := &tokens[i]
+		token.Symbol = strings.ToLower(strings.TrimSpace(token.Symbol))
+		if token.Symbol == "" {
+			return nil, fmt.Errorf("token %d has no symbol", i)
+		}
+		if seen[token.Symbol] {
+			return nil, fmt.Errorf("token %s is listed twice", token.Symbol)
+		}
+		seen[token.Symbol] = true
+
+		address, err := checksumAddress(token.Address)
+		if err != nil {
+			return nil, fmt.Errorf("token %s: %w", token.Symbol, err)
+		}
+		token.Address = address
+		if token.Decimals == nil || *token.Decimals < 0 || *token.Decimals > MAX_DECIMAL_PLACES {
+			return nil, fmt.Errorf("token %s: decimals must be between 0 and %d", token.Symbol, MAX_DECIMAL_PLACES)
+		}
+		if token.ChainDecimals == nil {
+			// wei amounts and /onchain can't be converted without them
+			if _, known := builtin[token.Symbol]; !known {
+				return nil, fmt.Errorf("token %s: chain_decimals is required for a token that isn't built in", token.Symbol)
+			}
+		} else if *token.ChainDecimals < 0 || *token.ChainDecimals > 36 {
+			return nil, fmt.Errorf("token %s: chain_decimals must be between 0 and 36", token.Symbol)
+		}
+		if token.MinAmount < 0 || token.MaxAmount < 0 || (token.MaxAmount > 0 && token.MinAmount > token.MaxAmount) {
+			return nil, fmt.Errorf("token %s: min_amount and max_amount must be positive with min below max", token.Symbol)
+		}
+	}
+	return tokens, nil
+}
+
+func (l TokenList) addresses(builtin map[string]string) map[string]string {
+	for _, token := range l {
+		builtin[token.Symbol] = token.Address
+	}
+	return builtin
+}
+
+func (l TokenList) decimalPlaces(builtin map[string]int) map[string]int {
+	for _, token := range l {
+		builtin[token.Symbol] = *token.Decimals
+	}
+	return builtin
+}
+
+// chainDecimals leaves a built-in token's on-chain decimals in place when
+// the file doesn't give them.
+func (l TokenList) chainDecimals(builtin map[string]int) map[string]int {
+	for _, token := range l {
+		if token.ChainDecimals != nil {
+			builtin[token.Symbol] = *token.ChainDecimals
+		}
+	}
+	return builtin
+}
+
+func (l TokenList) amountLimits(builtin map[string]AmountLimit) map[string]AmountLimit {
+	for _, token := range l {
+		if token.MinAmount > 0 || token.MaxAmount > 0 {
+			builtin[token.Symbol] = AmountLimit{Min: token.MinAmount, Max: token.MaxAmount}
+		}
+	}
+	return builtin
+}
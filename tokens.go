@@ -0,0 +1,30 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TokenInfo struct {
+	Symbol        string `json:"symbol"`
+	Address       string `json:"address"`
+	DecimalPlaces int    `json:"decimal_places"`
+	ChainDecimals int    `json:"chain_decimals,omitempty"`
+}
+
+// handleTokens lists the supported tokens sorted by symbol, with the decimal
+// places quotes are reported in and the token's on-chain decimals.
+func handleTokens(c *gin.Context) {
+	symbols := sortedTokenSymbols()
+	tokens := make([]TokenInfo, 0, len(symbols))
+	for _, symbol := range symbols {
+		tokens = append(tokens, TokenInfo{
+			Symbol:        symbol,
+			Address:       tokenAddresses[symbol],
+			DecimalPlaces: outputDecimalPlaces(symbol),
+			ChainDecimals: tokenChainDecimals[symbol],
+		})
+	}
+	c.JSON(http.StatusOK, tokens)
+}
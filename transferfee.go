@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// transferFeeBps holds the fee-on-transfer, in basis points, taken by tokens
+// that burn or redirect part of every transfer. TRANSFER_FEE_BPS is a JSON
+// object such as {"dak": 50}.
+var transferFeeBps map[string]float64
+
+func loadTransferFees(value string) (map[string]float64, error) {
+	fees := map[string]float64{}
+	if value == "" {
+		return fees, nil
+	}
+	if err := json.Unmarshal([]byte(value), &fees); err != nil {
+		return nil, fmt.Errorf("invalid TRANSFER_FEE_BPS: %w", err)
+	}
+	for token, bps := range fees {
+		if bps < 0 || bps >= 10000 {
+			return nil, fmt.Errorf("TRANSFER_FEE_BPS for %s must be between 0 and 10000, got %v", token, bps)
+		}
+	}
+	return fees, nil
+}
+
+// applyTransferFee reduces the output to what actually arrives after the
+// output token's fee-on-transfer, keeping the quoted amount as the gross.
+func applyTransferFee(result *Result, decimalPlaces int) {
+	bps := transferFeeBps[result.Output.Token]
+	if bps == 0 {
+		return
+	}
+
+	factor := math.Pow10(decimalPlaces)
+	net := math.Floor(result.Output.Amount*(1-bps/10000)*factor) / factor
+
+	result.GrossOutputAmount = result.Output.Amount
+	result.TransferFeeBps = bps
+	result.Output.Amount = net
+	result.rawOutputAmount *= 1 - bps/10000
+	result.ExchangeRate = exchangeRate(net, result.Input.Amount)
+}
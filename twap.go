@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const TWAP_MAX_WINDOW = 24 * time.Hour
+
+// timeWeightedAverage weights each quote's rate by how long it stayed the
+// latest quote within [start, end]. A quote recorded before the window counts
+// from the start of the window until the first quote inside it.
+func timeWeightedAverage(points []QuotePoint, previous *QuotePoint, start, end time.Time) (float64, bool) {
+	if previous != nil {
+		points = append([]QuotePoint{{Result: previous.Result, RecordedAt: start}}, points...)
+	}
+	if len(points) == 0 {
+		return 0, false
+	}
+
+	var weighted, total float64
+	for i, point := range points {
+		until := end
+		if i+1 < len(points) {
+			until = points[i+1].RecordedAt
+		}
+		weight := until.Sub(point.RecordedAt).Seconds()
+		weighted += point.Result.ExchangeRate * weight
+		total += weight
+	}
+
+	if total == 0 {
+		// every sample landed at the same instant
+		return points[len(points)-1].Result.ExchangeRate, true
+	}
+	return weighted / total, true
+}
+
+func handleTWAP(c *gin.Context) {
+	inputToken := normalizeToken(c.Query("input"))
+	outputToken := normalizeToken(c.Query("output"))
+	if inputToken == "" || outputToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "input and output parameters are required"})
+		return
+	}
+
+	window, err := time.ParseDuration(c.DefaultQuery("window", "10m"))
+	if err != nil || window <= 0 || window > TWAP_MAX_WINDOW {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "window must be a positive duration up to " + TWAP_MAX_WINDOW.String()})
+		return
+	}
+
+	end := time.Now()
+	start := end.Add(-window)
+	points, previous := quoteHistory.Since(inputToken, outputToken, start)
+
+	if amount := c.Query("amount"); amount != "" {
+		// history records amounts as they are cached
+		amount = cacheKeyAmount(amount)
+		points = filterPointsByAmount(points, amount)
+		if previous != nil && previous.Amount != amount {
+			previous = nil
+		}
+	}
+
+	twap, ok := timeWeightedAverage(points, previous, start, end)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no quotes recorded for " + pairKey(inputToken, outputToken) + " in the last " + window.String()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"input":   inputToken,
+		"output":  outputToken,
+		"window":  window.String(),
+		"twap":    twap,
+		"samples": len(points),
+		"from":    start.Format(time.RFC3339),
+		"to":      end.Format(time.RFC3339),
+	})
+}
+
+func filterPointsByAmount(points []QuotePoint, amount string) []QuotePoint {
+	var filtered []QuotePoint
+	for _, point := range points {
+		if point.Amount == amount {
+			filtered = append(filtered, point)
+		}
+	}
+	return filtered
+}
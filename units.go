@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// tokenChainDecimals are the ERC-20 decimals of each token, i.e. the scale of
+// its base units. They have nothing to do with how many decimals we display.
+var tokenChainDecimals = builtinChainDecimals()
+
+func builtinChainDecimals() map[string]int {
+	return map[string]int{
+		"mon":  18,
+		"wmon": 18,
+		"dak":  18,
+		"lbtc": 8,
+		"usdc": 6,
+		"usdt": 6,
+		"eth":  18,
+		"wbtc": 8,
+	}
+}
+
+// weiToDecimal converts an integer amount of base units to the human decimal
+// string kuru expects, without going through a float.
+func weiToDecimal(wei string, decimals int) (string, error) {
+	value, ok := new(big.Int).SetString(wei, 10)
+	if !ok || value.Sign() <= 0 {
+		return "", fmt.Errorf("wei amount must be a positive integer: %s", wei)
+	}
+
+	digits := value.String()
+	if decimals == 0 {
+		return digits, nil
+	}
+	if len(digits) <= decimals {
+		digits = strings.Repeat("0", decimals-len(digits)+1) + digits
+	}
+
+	whole, fraction := digits[:len(digits)-decimals], strings.TrimRight(digits[len(digits)-decimals:], "0")
+	if fraction == "" {
+		return whole, nil
+	}
+	return whole + "." + fraction, nil
+}
+
+// parseUnits converts a human decimal string to base units exactly.
+func parseUnits(amount string, decimals int) (*big.Int, error) {
+	whole, fraction, _ := strings.Cut(strings.TrimSpace(amount), ".")
+	if len(fraction) > decimals {
+		return nil, fmt.Errorf("amount %s has more than %d decimals", amount, decimals)
+	}
+	value, ok := new(big.Int).SetString(whole+fraction+strings.Repeat("0", decimals-len(fraction)), 10)
+	if !ok || value.Sign() <= 0 {
+		return nil, fmt.Errorf("amount must be a positive decimal number: %s", amount)
+	}
+	return value, nil
+}
+
+// decimalToWei converts a human amount back to base units, truncating any
+// precision beyond the token's decimals.
+func decimalToWei(amount float64, decimals int) string {
+	whole, fraction, _ := strings.Cut(strconv.FormatFloat(amount, 'f', -1, 64), ".")
+	if len(fraction) > decimals {
+		fraction = fraction[:decimals]
+	}
+	fraction += strings.Repeat("0", decimals-len(fraction))
+
+	value, ok := new(big.Int).SetString(whole+fraction, 10)
+	if !ok {
+		return "0"
+	}
+	return value.String()
+}
+
+// maxAmount is the largest amount typed into kuru. Anything bigger is surely a
+// mistake and only makes the UI misbehave.
+var maxAmount = envFloat("MAX_AMOUNT", 1e15)
+
+// validateAmount accepts only a plain positive decimal up to maxAmount and
+// within the token's limits, so bad input is refused before a browser is
+// involved.
+func validateAmount(token, amount string) error {
+	if !plainDecimalPattern.MatchString(amount) {
+		return fmt.Errorf("amount must be a plain positive decimal number, got %q", amount)
+	}
+	value, err := strconv.ParseFloat(amount, 64)
+	if err != nil {
+		return fmt.Errorf("invalid amount %q: %w", amount, err)
+	}
+	if value <= 0 {
+		return fmt.Errorf("amount must be greater than zero")
+	}
+	if value > maxAmount {
+		return fmt.Errorf("amount must be at most %v", maxAmount)
+	}
+	return checkAmountLimits(token, value)
+}
+
+// maxAmountLength guards against kuru's input field silently truncating long
+// amount strings. AMOUNT_LENGTH_MODE decides what happens to longer amounts:
+// "reject" (the default) refuses them, "round" drops fractional digits until
+// the amount fits.
+var (
+	maxAmountLength  = envInt("MAX_AMOUNT_LENGTH", 24)
+	amountLengthMode = envString("AMOUNT_LENGTH_MODE", "reject")
+)
+
+func fitAmountLength(amount string) (string, error) {
+	if maxAmountLength <= 0 || len(amount) <= maxAmountLength {
+		return amount, nil
+	}
+	tooLong := fmt.Errorf("amount is %d characters long, the maximum is %d", len(amount), maxAmountLength)
+	if amountLengthMode != "round" {
+		return "", tooLong
+	}
+
+	whole, fraction, _ := strings.Cut(amount, ".")
+	if len(whole) > maxAmountLength {
+		return "", tooLong
+	}
+	digits := max(maxAmountLength-len(whole)-1, 0)
+	rounded := strings.TrimRight(fraction[:min(digits, len(fraction))], "0")
+	if rounded == "" {
+		return whole, nil
+	}
+	return whole + "." + rounded, nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gin-gonic/gin"
+)
+
+func handleValidateToken(c *gin.Context) {
+	address := c.Query("address")
+	if !common.IsHexAddress(address) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "address must be a 0x-prefixed 20-byte hex address"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	metadata, err := fetchTokenMetadata(ctx, common.HexToAddress(address))
+	if errors.Is(err, errRPCNotConfigured) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "not a valid ERC-20 token: " + err.Error()})
+		return
+	}
+
+	response := gin.H{
+		"address":  metadata.Address,
+		"name":     metadata.Name,
+		"symbol":   metadata.Symbol,
+		"decimals": metadata.Decimals,
+	}
+	if symbol, ok := symbolForAddress(metadata.Address); ok {
+		response["registered_as"] = symbol
+	}
+	c.JSON(http.StatusOK, response)
+}
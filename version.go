@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Build info, set at build time with
+//
+//	go build -ldflags "-X main.version=1.4.0 -X main.commit=$(git rev-parse HEAD) -X main.buildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// When built from a git checkout without them, the commit falls back to the
+// revision the Go toolchain stamped into the binary and the build time to
+// that revision's commit time.
+var (
+	version   = "dev"
+	commit    = ""
+	buildTime = ""
+)
+
+func buildInfo() gin.H {
+	revision, builtAt := commit, buildTime
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && revision == "":
+				revision = setting.Value
+			case setting.Key == "vcs.time" && builtAt == "":
+				builtAt = setting.Value
+			}
+		}
+	}
+	return gin.H{
+		"version":    version,
+		"commit":     revision,
+		"build_time": builtAt,
+		"go_version": runtime.Version(),
+	}
+}
+
+func handleVersion(c *gin.Context) {
+	c.JSON(http.StatusOK, buildInfo())
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Pairs quoted once at startup so the first real requests hit a warm cache.
+// WARMUP_PAIRS is a comma separated list of input/output/amount (the amount
+// defaults to 1); WARMUP_FILE names a JSON array of {"input", "output",
+// "amount"} objects. Both may be set. At most WARMUP_CONCURRENCY pairs are
+// scraped at a time, at low priority so live traffic goes first.
+var (
+	warmupPairs       = envString("WARMUP_PAIRS", "")
+	warmupFile        = envString("WARMUP_FILE", "")
+	warmupConcurrency = envInt("WARMUP_CONCURRENCY", 2)
+)
+
+func loadWarmupPairs() ([]BatchPair, error) {
+	var pairs []BatchPair
+	for _, entry := range strings.Split(warmupPairs, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		parts := strings.Split(entry, "/")
+		if len(parts) < 2 || len(parts) > 3 {
+			return nil, fmt.Errorf("WARMUP_PAIRS entry %q is not input/output[/amount]", entry)
+		}
+		pair := BatchPair{Input: parts[0], Output: parts[1], Amount: UNIT_AMOUNT}
+		if len(parts) == 3 {
+			pair.Amount = parts[2]
+		}
+		pairs = append(pairs, pair)
+	}
+
+	if warmupFile != "" {
+		data, err := os.ReadFile(warmupFile)
+		if err != nil {
+			return nil, err
+		}
+		var filePairs []BatchPair
+		if err := json.Unmarshal(data, &filePairs); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", warmupFile, err)
+		}
+		for _, pair := range filePairs {
+			if pair.Amount == "" {
+				pair.Amount = UNIT_AMOUNT
+			}
+			pairs = append(pairs, pair)
+		}
+	}
+	return pairs, nil
+}
+
+// warmCache quotes every warm-up pair into the cache. Failures are logged and
+// skipped.
+func warmCache(ctx context.Context) {
+	pairs, err := loadWarmupPairs()
+	if err != nil {
+		log.Printf("[WARMUP] %v", err)
+		return
+	}
+	if len(pairs) == 0 {
+		return
+	}
+
+	start := time.Now()
+	ctx = withPriority(ctx, PriorityLow)
+	slots := make(chan struct{}, max(warmupConcurrency, 1))
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	warmed := 0
+
+	for _, pair := range pairs {
+		pair, err := validateBatchPair(pair)
+		if err != nil {
+			log.Printf("[WARMUP] Skipping %s/%s: %v", pair.Input, pair.Output, err)
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-slots }()
+
+			if _, _, err := resolveQuote(ctx, pair.Input, pair.Output, pair.Amount, false); err != nil {
+				log.Printf("[WARMUP] Failed to quote %s %s to %s: %v", pair.Amount, pair.Input, pair.Output, err)
+				return
+			}
+			mutex.Lock()
+			warmed++
+			mutex.Unlock()
+		}()
+	}
+	wg.Wait()
+	log.Printf("[WARMUP] Cached %d of %d pairs in %v", warmed, len(pairs), time.Since(start).Round(time.Millisecond))
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+var (
+	hitRateThreshold   = envFloat("HIT_RATE_THRESHOLD", 0.5)
+	hitRateInterval    = envDuration("HIT_RATE_INTERVAL", time.Minute)
+	hitRateMinRequests = envInt("HIT_RATE_MIN_REQUESTS", 20)
+	hitRateWebhookURL  = envString("HIT_RATE_WEBHOOK_URL", "")
+
+	cacheStatsLogInterval = envDuration("CACHE_STATS_LOG_INTERVAL", time.Minute)
+)
+
+// runCacheStatsLogger logs the cumulative cache hit ratio every
+// CACHE_STATS_LOG_INTERVAL, staying quiet through intervals without lookups.
+func runCacheStatsLogger(ctx context.Context) {
+	if cacheStatsLogInterval <= 0 {
+		return
+	}
+
+	lastHits, lastMisses := cache.Counters()
+	ticker := time.NewTicker(cacheStatsLogInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			hits, misses := cache.Counters()
+			if hits == lastHits && misses == lastMisses {
+				continue
+			}
+			lastHits, lastMisses = hits, misses
+			log.Printf("[CACHE] Hit ratio %.2f (%d hits, %d misses since start)",
+				float64(hits)/float64(hits+misses), hits, misses)
+		}
+	}
+}
+
+// runHitRateWatchdog compares the cache hit/miss counters between ticks and
+// warns when the hit rate over the last interval falls below the threshold.
+// Intervals with fewer than HIT_RATE_MIN_REQUESTS lookups are skipped so a
+// handful of cold requests doesn't raise an alarm.
+func runHitRateWatchdog(ctx context.Context) {
+	if hitRateThreshold <= 0 || hitRateInterval <= 0 {
+		return
+	}
+
+	lastHits, lastMisses := cache.Counters()
+	ticker := time.NewTicker(hitRateInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		hits, misses := cache.Counters()
+		windowHits, windowMisses := hits-lastHits, misses-lastMisses
+		lastHits, lastMisses = hits, misses
+
+		total := windowHits + windowMisses
+		if total < int64(hitRateMinRequests) {
+			continue
+		}
+
+		hitRate := float64(windowHits) / float64(total)
+		if hitRate >= hitRateThreshold {
+			continue
+		}
+
+		log.Printf("[WATCHDOG] Cache hit rate %.2f over the last %v is below threshold %.2f (%d hits, %d misses)",
+			hitRate, hitRateInterval, hitRateThreshold, windowHits, windowMisses)
+		if hitRateWebhookURL != "" {
+			notifyHitRateWebhook(hitRate, windowHits, windowMisses)
+		}
+	}
+}
+
+func notifyHitRateWebhook(hitRate float64, hits, misses int64) {
+	payload, err := json.Marshal(map[string]interface{}{
+		"alert":     "cache_hit_rate_low",
+		"hit_rate":  hitRate,
+		"threshold": hitRateThreshold,
+		"hits":      hits,
+		"misses":    misses,
+		"window":    hitRateInterval.String(),
+		"timestamp": time.Now().Format(time.RFC3339),
+	})
+	if err != nil {
+		log.Printf("[WATCHDOG] Failed to encode webhook payload: %v", err)
+		return
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(hitRateWebhookURL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		log.Printf("[WATCHDOG] Failed to deliver webhook: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("[WATCHDOG] Webhook responded with status %d", resp.StatusCode)
+	}
+}